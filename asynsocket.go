@@ -1,468 +1,911 @@
-package netgo
-
-import (
-	"context"
-	"errors"
-	"net"
-	"sync"
-	"sync/atomic"
-	"time"
-
-	"github.com/sniperHW/netgo/poolbuff"
-)
-
-var (
-	ErrRecvTimeout            error = errors.New("recvTimeout")
-	ErrPushToSendQueueTimeout error = errors.New("pushToSendQueueTimeout")
-	ErrSendQueueFull          error = errors.New("sendQueueFull")
-	ErrAsynSendTimeout        error = errors.New("asynSendTimeout")
-	ErrSocketClosed           error = errors.New("socketClosed")
-)
-
-var MaxSendBlockSize int = 65535
-
-type ObjCodec interface {
-	Decode([]byte) (interface{}, error)
-	Encode(net.Buffers, interface{}) (net.Buffers, int)
-}
-
-type AsynSocketOption struct {
-	Codec            ObjCodec
-	SendChanSize     int
-	AsyncSendTimeout time.Duration
-	AutoRecv         bool          //处理完packet后自动调用Recv
-	AutoRecvTimeout  time.Duration //自动调用Recv时的超时时间
-	Context          context.Context
-}
-
-type defaultCodec struct {
-}
-
-func (codec *defaultCodec) Encode(buffs net.Buffers, o interface{}) (net.Buffers, int) {
-	if b, ok := o.([]byte); ok {
-		return append(buffs, b), len(b)
-	} else {
-		return buffs, 0
-	}
-}
-
-func (codec *defaultCodec) Decode(buff []byte) (interface{}, error) {
-	packet := make([]byte, len(buff))
-	copy(packet, buff)
-	return packet, nil
-}
-
-type wrCounter struct {
-	sync.Mutex
-	w int
-	r int
-}
-
-func (c *wrCounter) addW(v int) (w int, r int) {
-	c.Lock()
-	c.w += v
-	w = c.w
-	r = c.r
-	c.Unlock()
-	return w, r
-}
-
-func (c *wrCounter) addR(v int) (w int, r int) {
-	c.Lock()
-	c.r += v
-	w = c.w
-	r = c.r
-	c.Unlock()
-	return w, r
-}
-
-func (c *wrCounter) getWR() (w int, r int) {
-	c.Lock()
-	w = c.w
-	r = c.r
-	c.Unlock()
-	return w, r
-}
-
-// asynchronize encapsulation for Socket
-type AsynSocket struct {
-	socket           Socket
-	codec            ObjCodec
-	die              chan struct{}
-	recvReq          chan time.Time
-	sendReq          chan interface{}
-	sendOnce         sync.Once
-	recvOnce         sync.Once
-	wrCounter        wrCounter
-	closeOnce        sync.Once
-	closeReason      atomic.Value
-	doCloseOnce      sync.Once
-	closeCallBack    atomic.Value //func(*AsynSocket, error),call when wrCounter.w == 0 && wrCounter.r == 0
-	handlePakcet     atomic.Value //func(context.Context, *AsynSocket, interface{}) error
-	onRecvTimeout    atomic.Value //func(*AsynSocket)
-	asyncSendTimeout time.Duration
-	autoRecv         bool
-	autoRecvTimeout  time.Duration
-	context          context.Context
-}
-
-func NewAsynSocket(socket Socket, option AsynSocketOption) *AsynSocket {
-
-	if option.SendChanSize <= 0 {
-		option.SendChanSize = 1
-	}
-
-	s := &AsynSocket{
-		socket:           socket,
-		die:              make(chan struct{}),
-		recvReq:          make(chan time.Time, 1),
-		sendReq:          make(chan interface{}, option.SendChanSize),
-		asyncSendTimeout: option.AsyncSendTimeout,
-		autoRecv:         option.AutoRecv,
-		autoRecvTimeout:  option.AutoRecvTimeout,
-		codec:            option.Codec,
-		context:          option.Context,
-	}
-
-	if s.codec == nil {
-		s.codec = &defaultCodec{}
-	}
-
-	if s.context == nil {
-		s.context = context.Background()
-	}
-
-	s.closeCallBack.Store(func(*AsynSocket, error) {
-
-	})
-
-	s.onRecvTimeout.Store(func(*AsynSocket) {
-		s.close(ErrRecvTimeout, false)
-	})
-
-	s.handlePakcet.Store(func(context.Context, *AsynSocket, interface{}) error {
-		s.Recv()
-		return nil
-	})
-
-	return s
-}
-
-func (s *AsynSocket) SetCloseCallback(closeCallBack func(*AsynSocket, error)) *AsynSocket {
-	if closeCallBack != nil {
-		s.closeCallBack.Store(closeCallBack)
-	}
-	return s
-}
-
-func (s *AsynSocket) SetRecvTimeoutCallback(onRecvTimeout func(*AsynSocket)) *AsynSocket {
-	if onRecvTimeout != nil {
-		s.onRecvTimeout.Store(onRecvTimeout)
-	}
-	return s
-}
-
-// make sure to SetPacketHandler before the first Recv
-//
-// after Recv start recvloop, packethandler can't be change anymore
-func (s *AsynSocket) SetPacketHandler(handlePakcet func(context.Context, *AsynSocket, interface{}) error) *AsynSocket {
-	if handlePakcet != nil {
-		s.handlePakcet.Store(handlePakcet)
-	}
-	return s
-}
-
-func (s *AsynSocket) GetUnderSocket() Socket {
-	return s.socket
-}
-
-func (s *AsynSocket) LocalAddr() net.Addr {
-	return s.socket.LocalAddr()
-}
-
-func (s *AsynSocket) RemoteAddr() net.Addr {
-	return s.socket.RemoteAddr()
-}
-
-func (s *AsynSocket) SetUserData(ud interface{}) {
-	s.socket.SetUserData(ud)
-}
-
-func (s *AsynSocket) GetUserData() interface{} {
-	return s.socket.GetUserData()
-}
-
-func (s *AsynSocket) GetUnderConn() interface{} {
-	return s.socket.GetUnderConn()
-}
-
-func (s *AsynSocket) doClose() {
-	once := false
-	s.doCloseOnce.Do(func() {
-		once = true
-	})
-	if once {
-		s.socket.Close()
-		reason, _ := s.closeReason.Load().(error)
-		s.closeCallBack.Load().(func(*AsynSocket, error))(s, reason)
-	}
-}
-
-func (s *AsynSocket) close(err error, closeBySendRoutine bool) {
-	s.closeOnce.Do(func() {
-		if nil != err {
-			s.closeReason.Store(err)
-		}
-		close(s.die)
-		if closeBySendRoutine {
-			s.socket.Close()
-		}
-	})
-}
-
-func (s *AsynSocket) Close(err error) {
-	s.closeOnce.Do(func() {
-		if nil != err {
-			s.closeReason.Store(err)
-		}
-		close(s.die)
-		w, r := s.wrCounter.getWR()
-		if w == 0 {
-			if r == 0 {
-				//读写routine均未启动,直接doClose
-				go s.doClose()
-			} else {
-				//写routine尚未启动，读routine可能阻塞在s.socket.Recv(deadline),调用Close以解除可能的阻塞
-				s.socket.Close()
-			}
-		}
-	})
-}
-
-// send a asynchronize recv request
-//
-// if there is a packet received before timeout,handlePakcet would be call with packet as a parameter
-//
-// if recevie timeout,on onReceTimeout would be call
-//
-// if recvReq is full,drop the request
-func (s *AsynSocket) Recv(deadline ...time.Time) *AsynSocket {
-	s.recvOnce.Do(s.recvloop)
-	d := time.Time{}
-	if len(deadline) > 0 {
-		d = deadline[0]
-	}
-	select {
-	case <-s.die:
-	case s.recvReq <- d:
-	default:
-	}
-	return s
-}
-
-func (s *AsynSocket) recvloop() {
-	s.wrCounter.addR(1)
-	packetHandler := s.handlePakcet.Load().(func(context.Context, *AsynSocket, interface{}) error)
-	go func() {
-		defer func() {
-			w, _ := s.wrCounter.addR(-1)
-			if w == 0 {
-				s.doClose()
-			}
-		}()
-
-		var (
-			buff   []byte
-			err    error
-			packet interface{}
-		)
-		for {
-			select {
-			case <-s.die:
-				return
-			case deadline := <-s.recvReq:
-				buff, err = s.socket.Recv(deadline)
-				select {
-				case <-s.die:
-					return
-				default:
-					if nil == err {
-						packet, err = s.codec.Decode(buff)
-					}
-					if nil == err {
-						if err = packetHandler(s.context, s, packet); err != nil {
-							s.close(err, false)
-							return
-						}
-					} else if IsNetTimeoutError(err) {
-						s.onRecvTimeout.Load().(func(*AsynSocket))(s)
-					} else {
-						s.close(err, false)
-						return
-					}
-
-					if s.autoRecv {
-						var readdeadline time.Time
-						if s.autoRecvTimeout > 0 {
-							readdeadline = time.Now().Add(s.autoRecvTimeout)
-						}
-						select {
-						case s.recvReq <- readdeadline:
-						default:
-						}
-					}
-				}
-			}
-		}
-	}()
-}
-
-func (s *AsynSocket) sendBuffs(buffs net.Buffers) (err error) {
-	deadline := time.Time{}
-	if s.asyncSendTimeout > 0 {
-		deadline = time.Now().Add(s.asyncSendTimeout)
-	}
-
-	if buffersSender, ok := s.socket.(BuffersSender); ok {
-		_, err = buffersSender.SendBuffers(buffs, deadline)
-	} else {
-		outputBuffer := poolbuff.Get()
-		defer poolbuff.Put(outputBuffer)
-		for _, v := range buffs {
-			outputBuffer = append(outputBuffer, v...)
-		}
-		_, err = s.socket.Send(outputBuffer, deadline)
-	}
-
-	if nil != err && IsNetTimeoutError(err) {
-		err = ErrAsynSendTimeout
-	}
-
-	return err
-}
-
-func (s *AsynSocket) sendloop() {
-	s.wrCounter.addW(1)
-	go func() {
-		var (
-			err error
-		)
-		defer func() {
-			_, r := s.wrCounter.addW(-1)
-			if r == 0 {
-				s.doClose()
-			} else {
-				//recvloop可能阻塞在s.socket.Recv(deadline),close socket让调用返回错误
-				s.socket.Close()
-			}
-		}()
-
-		maxBuffSize := 1024
-		total := 0
-		n := 0
-		buffs := make(net.Buffers, 0, 8)
-		for {
-			select {
-			case <-s.die:
-				for len(s.sendReq) > 0 {
-					o := <-s.sendReq
-					buffs, n = s.codec.Encode(buffs, o)
-					total += n
-					if total >= MaxSendBlockSize || len(buffs) >= maxBuffSize {
-						if s.sendBuffs(buffs) != nil {
-							return
-						} else {
-							buffs = buffs[:0]
-							total = 0
-						}
-					}
-				}
-
-				if total > 0 {
-					s.sendBuffs(buffs)
-				}
-				return
-			case o := <-s.sendReq:
-				buffs, n = s.codec.Encode(buffs, o)
-				total += n
-				if (total >= MaxSendBlockSize || len(buffs) >= maxBuffSize) || (total > 0 && len(s.sendReq) == 0) {
-					if err = s.sendBuffs(buffs); nil != err {
-						s.close(err, true)
-						return
-					}
-					if cap(buffs) < 64 {
-						for i := 0; i < len(buffs); i++ {
-							buffs[i] = nil
-						}
-						buffs = buffs[:0]
-					} else {
-						buffs = make(net.Buffers, 0, 8)
-					}
-					total = 0
-				}
-			}
-		}
-	}()
-}
-
-func (s *AsynSocket) getTimeout(deadline []time.Time) time.Duration {
-	if len(deadline) > 0 {
-		if deadline[0].IsZero() {
-			return -1
-		} else {
-			return time.Until(deadline[0])
-		}
-	} else {
-		return 0
-	}
-}
-
-// deadline: 如果不传递，当发送chan满一直等待
-// deadline.IsZero() || deadline.Before(time.Now):当chan满立即返回ErrSendBusy
-// 否则当发送chan满等待到deadline,返回ErrPushToSendQueueTimeout
-func (s *AsynSocket) Send(o interface{}, deadline ...time.Time) error {
-	s.sendOnce.Do(s.sendloop)
-	if timeout := s.getTimeout(deadline); timeout == 0 {
-		//if senReq has no space wait forever
-		select {
-		case <-s.die:
-			return ErrSocketClosed
-		case s.sendReq <- o:
-			return nil
-		}
-	} else if timeout > 0 {
-		//if sendReq has no space,wait until deadline
-		ticker := time.NewTicker(timeout)
-		defer ticker.Stop()
-		select {
-		case <-s.die:
-			return ErrSocketClosed
-		case <-ticker.C:
-			return ErrPushToSendQueueTimeout
-		case s.sendReq <- o:
-			return nil
-		}
-	} else {
-		//if sendReq has no space,return busy
-		select {
-		case <-s.die:
-			return ErrSocketClosed
-		case s.sendReq <- o:
-			return nil
-		default:
-			return ErrSendQueueFull
-		}
-	}
-}
-
-func (s *AsynSocket) SendWithContext(ctx context.Context, o interface{}) error {
-	s.sendOnce.Do(s.sendloop)
-	select {
-	case <-s.die:
-		return ErrSocketClosed
-	case s.sendReq <- o:
-		return nil
-	case <-ctx.Done():
-		return ctx.Err()
-	}
-}
+package netgo
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sniperHW/netgo/poolbuff"
+)
+
+var (
+	ErrRecvTimeout            error = errors.New("recvTimeout")
+	ErrPushToSendQueueTimeout error = errors.New("pushToSendQueueTimeout")
+	ErrSendQueueFull          error = errors.New("sendQueueFull")
+	ErrAsynSendTimeout        error = errors.New("asynSendTimeout")
+	ErrSocketClosed           error = errors.New("socketClosed")
+	ErrWriteClosed            error = errors.New("writeClosed")
+)
+
+var MaxSendBlockSize int = 65535
+
+// send lane of AsynSocket
+type Priority int
+
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+	priorityCount
+)
+
+const (
+	lowPriorityRound    = 16
+	normalPriorityRound = 4
+)
+
+type ObjCodec interface {
+	Decode([]byte) (interface{}, error)
+	Encode(net.Buffers, interface{}) (net.Buffers, int)
+}
+
+type AsynSocketOption struct {
+	Codec                    ObjCodec
+	SendChanSize             int //capacity of PriorityNormal lane
+	HighPrioritySendChanSize int //capacity of PriorityHigh lane,default SendChanSize
+	LowPrioritySendChanSize  int //capacity of PriorityLow lane,default SendChanSize
+	AsyncSendTimeout         time.Duration
+	AutoRecv                 bool          //处理完packet后自动调用Recv
+	AutoRecvTimeout          time.Duration //自动调用Recv时的超时时间
+	Context                  context.Context
+	//packet is passed to codec without copy,see PacketReleaser.
+	//
+	//with the default codec,the packet handler receives the packet itself and could release it by AsynSocket.ReleasePacket.
+	//
+	//with other codecs,the packet is released after Decode,codec mustn't keep reference to the packet.
+	ZeroCopy bool
+	//ping/pong messages,they are consumed before packet handler,pong is replied automatically
+	Heartbeat Heartbeat
+	//send a ping every PingInterval,socket is closed with ErrHeartbeatTimeout if pong not received before the next ping
+	PingInterval time.Duration
+	//socket is closed with ErrHeartbeatTimeout if nothing received for IdleReadTimeout
+	IdleReadTimeout time.Duration
+	//send a ping if nothing written for IdleWriteTimeout
+	IdleWriteTimeout time.Duration
+	//estimated encoded size of object in send queue,[]byte,string and *SharedPacket are counted by length.
+	//objects are counted as 0 byte if SizeOf is nil
+	SizeOf func(interface{}) int
+	//OnUnwritable is called when queued bytes reached HighWaterMark,OnWritable is called when it dropped to LowWaterMark.
+	//
+	//queued bytes include objects taken from the send queue but not written yet,watermark is disabled if HighWaterMark <= 0
+	//
+	//callbacks are called in the goroutine changed queued bytes,OnWritable usually in the send goroutine,
+	//they mustn't block,e.g. Send without deadline in OnWritable may deadlock the send goroutine when the send queue is full.
+	HighWaterMark int
+	LowWaterMark  int //default HighWaterMark/2
+	OnWritable    func(*AsynSocket)
+	OnUnwritable  func(*AsynSocket)
+	//limit bytes written by sendloop,could be shared by many sockets.
+	//
+	//queued objects are still throttled while flushing after Close,Shutdown drops the rest objects when ctx done
+	SendLimiter *RateLimiter
+	//limit bytes read by recvloop,tokens are charged after read
+	RecvLimiter *RateLimiter
+	//run packet handler on Executor instead of recvloop,handlers of the socket are run in order.
+	//
+	//handlers submitted before close are still run,close callback is called after they returned,
+	//unless the Executor is stopped or Shutdown's ctx is done.
+	//
+	//handlers mustn't wait on Done or call Shutdown,they would wait for themselves.
+	//
+	//the default codec always copies the packet with Executor,ZeroCopy is ignored.
+	Executor *Executor
+	//recvloop stops reading while MaxPendingTasks handlers are pending,default 16
+	MaxPendingTasks int
+}
+
+type defaultCodec struct {
+	zeroCopy bool
+}
+
+func (codec *defaultCodec) Encode(buffs net.Buffers, o interface{}) (net.Buffers, int) {
+	if b, ok := o.([]byte); ok {
+		return append(buffs, b), len(b)
+	} else {
+		return buffs, 0
+	}
+}
+
+func (codec *defaultCodec) Decode(buff []byte) (interface{}, error) {
+	if codec.zeroCopy {
+		return buff, nil
+	}
+	packet := make([]byte, len(buff))
+	copy(packet, buff)
+	return packet, nil
+}
+
+type wrCounter struct {
+	sync.Mutex
+	w int
+	r int
+}
+
+func (c *wrCounter) addW(v int) (w int, r int) {
+	c.Lock()
+	c.w += v
+	w = c.w
+	r = c.r
+	c.Unlock()
+	return w, r
+}
+
+func (c *wrCounter) addR(v int) (w int, r int) {
+	c.Lock()
+	c.r += v
+	w = c.w
+	r = c.r
+	c.Unlock()
+	return w, r
+}
+
+func (c *wrCounter) getWR() (w int, r int) {
+	c.Lock()
+	w = c.w
+	r = c.r
+	c.Unlock()
+	return w, r
+}
+
+// asynchronize encapsulation for Socket
+type AsynSocket struct {
+	socket           Socket
+	codec            ObjCodec
+	die              chan struct{}
+	done             chan struct{} //closed after close callback returned
+	writeClosed      chan struct{}
+	forceClose       chan struct{} //closed when Shutdown gave up flushing
+	forceCloseOnce   sync.Once
+	closeWriteOnce   sync.Once
+	recvReq          chan time.Time
+	sendReq          [priorityCount]chan interface{}
+	sendOnce         sync.Once
+	recvOnce         sync.Once
+	wrCounter        wrCounter
+	closeOnce        sync.Once
+	closeReason      atomic.Value
+	doCloseOnce      sync.Once
+	closeCallBack    atomic.Value //func(*AsynSocket, error),call when wrCounter.w == 0 && wrCounter.r == 0
+	handlePakcet     atomic.Value //func(context.Context, *AsynSocket, interface{}) error
+	onRecvTimeout    atomic.Value //func(*AsynSocket)
+	asyncSendTimeout time.Duration
+	autoRecv         bool
+	autoRecvTimeout  time.Duration
+	context          context.Context
+	releasePacket    bool
+	id               uint64
+	listenerMu       sync.Mutex
+	closeListeners   map[uint64]func(*AsynSocket, error) //internal callbacks,e.g. Group,call before closeCallBack
+	nextListenerID   uint64
+	closed           bool
+	heartbeat        *heartbeat
+	sendClosed       int32 //set when sendloop exited
+	sizeOf           func(interface{}) int
+	queuedBytes      int64
+	highWaterMark    int64
+	lowWaterMark     int64
+	writabilityMu    sync.Mutex
+	unwritable       bool
+	onWritable       func(*AsynSocket)
+	onUnwritable     func(*AsynSocket)
+	sendLimiter      *RateLimiter
+	recvLimiter      *RateLimiter
+	stats            statsCounter
+	tasks            *taskQueue
+	maxPendingTasks  int
+}
+
+var nextSocketID uint64
+
+func NewAsynSocket(socket Socket, option AsynSocketOption) *AsynSocket {
+
+	if option.SendChanSize <= 0 {
+		option.SendChanSize = 1
+	}
+
+	if option.HighPrioritySendChanSize <= 0 {
+		option.HighPrioritySendChanSize = option.SendChanSize
+	}
+
+	if option.LowPrioritySendChanSize <= 0 {
+		option.LowPrioritySendChanSize = option.SendChanSize
+	}
+
+	s := &AsynSocket{
+		socket:           socket,
+		die:              make(chan struct{}),
+		done:             make(chan struct{}),
+		writeClosed:      make(chan struct{}),
+		forceClose:       make(chan struct{}),
+		recvReq:          make(chan time.Time, 1),
+		asyncSendTimeout: option.AsyncSendTimeout,
+		autoRecv:         option.AutoRecv,
+		autoRecvTimeout:  option.AutoRecvTimeout,
+		codec:            option.Codec,
+		context:          option.Context,
+		id:               atomic.AddUint64(&nextSocketID, 1),
+		heartbeat:        newHeartbeat(option),
+		sizeOf:           option.SizeOf,
+		highWaterMark:    int64(option.HighWaterMark),
+		lowWaterMark:     int64(option.LowWaterMark),
+		onWritable:       option.OnWritable,
+		onUnwritable:     option.OnUnwritable,
+		sendLimiter:      option.SendLimiter,
+		recvLimiter:      option.RecvLimiter,
+	}
+
+	if s.lowWaterMark <= 0 || s.lowWaterMark > s.highWaterMark {
+		s.lowWaterMark = s.highWaterMark / 2
+	}
+
+	s.stats.init()
+
+	if option.Executor != nil {
+		s.tasks = newTaskQueue(option.Executor)
+		s.maxPendingTasks = option.MaxPendingTasks
+		if s.maxPendingTasks <= 0 {
+			s.maxPendingTasks = 16
+		}
+	}
+
+	s.sendReq[PriorityLow] = make(chan interface{}, option.LowPrioritySendChanSize)
+	s.sendReq[PriorityNormal] = make(chan interface{}, option.SendChanSize)
+	s.sendReq[PriorityHigh] = make(chan interface{}, option.HighPrioritySendChanSize)
+
+	if s.codec == nil {
+		//handler on Executor runs after the next Recv,which may overwrite the buffer
+		zeroCopy := option.ZeroCopy && option.Executor == nil
+		s.codec = &defaultCodec{zeroCopy: zeroCopy}
+		//default codec copies the packet if not ZeroCopy,give back the buffer after Decode
+		s.releasePacket = !zeroCopy
+	} else {
+		s.releasePacket = option.ZeroCopy
+	}
+
+	if s.context == nil {
+		s.context = context.Background()
+	}
+
+	s.closeCallBack.Store(func(*AsynSocket, error) {
+
+	})
+
+	s.onRecvTimeout.Store(func(*AsynSocket) {
+		s.close(ErrRecvTimeout, false)
+	})
+
+	s.handlePakcet.Store(func(context.Context, *AsynSocket, interface{}) error {
+		s.Recv()
+		return nil
+	})
+
+	s.startHeartbeat()
+
+	return s
+}
+
+func (s *AsynSocket) SetCloseCallback(closeCallBack func(*AsynSocket, error)) *AsynSocket {
+	if closeCallBack != nil {
+		s.closeCallBack.Store(closeCallBack)
+	}
+	return s
+}
+
+func (s *AsynSocket) SetRecvTimeoutCallback(onRecvTimeout func(*AsynSocket)) *AsynSocket {
+	if onRecvTimeout != nil {
+		s.onRecvTimeout.Store(onRecvTimeout)
+	}
+	return s
+}
+
+// make sure to SetPacketHandler before the first Recv
+//
+// after Recv start recvloop, packethandler can't be change anymore
+func (s *AsynSocket) SetPacketHandler(handlePakcet func(context.Context, *AsynSocket, interface{}) error) *AsynSocket {
+	if handlePakcet != nil {
+		s.handlePakcet.Store(handlePakcet)
+	}
+	return s
+}
+
+func (s *AsynSocket) GetUnderSocket() Socket {
+	return s.socket
+}
+
+func (s *AsynSocket) LocalAddr() net.Addr {
+	return s.socket.LocalAddr()
+}
+
+func (s *AsynSocket) RemoteAddr() net.Addr {
+	return s.socket.RemoteAddr()
+}
+
+func (s *AsynSocket) SetUserData(ud interface{}) {
+	s.socket.SetUserData(ud)
+}
+
+func (s *AsynSocket) GetUserData() interface{} {
+	return s.socket.GetUserData()
+}
+
+func (s *AsynSocket) GetUnderConn() interface{} {
+	return s.socket.GetUnderConn()
+}
+
+// give back packet received in ZeroCopy mode
+func (s *AsynSocket) ReleasePacket(packet []byte) {
+	if releaser, ok := s.socket.(PacketReleaser); ok {
+		releaser.ReleasePacket(packet)
+	}
+}
+
+func (s *AsynSocket) doClose() {
+	once := false
+	s.doCloseOnce.Do(func() {
+		once = true
+	})
+	if once {
+		s.socket.Close()
+		reason, _ := s.closeReason.Load().(error)
+		s.listenerMu.Lock()
+		s.closed = true
+		listeners := s.closeListeners
+		s.closeListeners = nil
+		s.listenerMu.Unlock()
+		for _, fn := range listeners {
+			fn(s, reason)
+		}
+		s.closeCallBack.Load().(func(*AsynSocket, error))(s, reason)
+		close(s.done)
+	}
+}
+
+// add an internal close listener without replacing the close callback,return false if the socket is already closed
+func (s *AsynSocket) addCloseListener(fn func(*AsynSocket, error)) (uint64, bool) {
+	s.listenerMu.Lock()
+	defer s.listenerMu.Unlock()
+	if s.closed {
+		return 0, false
+	}
+	if s.closeListeners == nil {
+		s.closeListeners = map[uint64]func(*AsynSocket, error){}
+	}
+	s.nextListenerID++
+	s.closeListeners[s.nextListenerID] = fn
+	return s.nextListenerID, true
+}
+
+func (s *AsynSocket) removeCloseListener(id uint64) {
+	s.listenerMu.Lock()
+	delete(s.closeListeners, id)
+	s.listenerMu.Unlock()
+}
+
+func (s *AsynSocket) close(err error, closeBySendRoutine bool) {
+	s.closeOnce.Do(func() {
+		if nil != err {
+			s.closeReason.Store(err)
+		}
+		close(s.die)
+		if closeBySendRoutine {
+			s.socket.Close()
+		}
+	})
+}
+
+func (s *AsynSocket) Close(err error) {
+	s.closeOnce.Do(func() {
+		if nil != err {
+			s.closeReason.Store(err)
+		}
+		close(s.die)
+		w, r := s.wrCounter.getWR()
+		if w == 0 {
+			if r == 0 {
+				//读写routine均未启动,直接doClose
+				go s.doClose()
+			} else {
+				//写routine尚未启动，读routine可能阻塞在s.socket.Recv(deadline),调用Close以解除可能的阻塞
+				s.socket.Close()
+			}
+		}
+	})
+}
+
+// half close,stop accepting new sends,flush queued objects and then close the write side of the socket.
+//
+// recvloop keeps running until the peer closed,return ErrCloseWriteNotSupported if the socket doesn't support half close
+func (s *AsynSocket) CloseWrite() error {
+	if cw, ok := s.socket.(CloseWriter); !ok || !cw.CanCloseWrite() {
+		return ErrCloseWriteNotSupported
+	}
+	s.closeWriteOnce.Do(func() {
+		close(s.writeClosed)
+		s.sendOnce.Do(s.sendloop)
+	})
+	return nil
+}
+
+func (s *AsynSocket) isWriteClosed() bool {
+	select {
+	case <-s.writeClosed:
+		return true
+	default:
+		return false
+	}
+}
+
+// closed after the socket closed and close callback returned
+func (s *AsynSocket) Done() <-chan struct{} {
+	return s.done
+}
+
+// reason of close,nil if the socket is not closed or closed without reason
+func (s *AsynSocket) Err() error {
+	err, _ := s.closeReason.Load().(error)
+	return err
+}
+
+// graceful close,stop accepting new sends and flush queued objects,
+// the socket is force closed if ctx is done before flushed.
+//
+// Shutdown blocks until close callback returned,return ctx.Err() if force closed.
+func (s *AsynSocket) Shutdown(ctx context.Context) error {
+	s.Close(nil)
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		//unblock the pending write or limiter wait,sendloop completes the rest objects with ErrSocketClosed
+		s.forceCloseOnce.Do(func() {
+			close(s.forceClose)
+		})
+		s.socket.Close()
+		<-s.done
+		return ctx.Err()
+	}
+}
+
+// send a asynchronize recv request
+//
+// if there is a packet received before timeout,handlePakcet would be call with packet as a parameter
+//
+// if recevie timeout,on onReceTimeout would be call
+//
+// if recvReq is full,drop the request
+func (s *AsynSocket) Recv(deadline ...time.Time) *AsynSocket {
+	s.recvOnce.Do(s.recvloop)
+	d := time.Time{}
+	if len(deadline) > 0 {
+		d = deadline[0]
+	}
+	select {
+	case <-s.die:
+	case s.recvReq <- d:
+	default:
+	}
+	return s
+}
+
+func (s *AsynSocket) recvloop() {
+	s.wrCounter.addR(1)
+	packetHandler := s.handlePakcet.Load().(func(context.Context, *AsynSocket, interface{}) error)
+	go func() {
+		defer func() {
+			if s.tasks != nil {
+				//close callback is called after submitted handlers returned,unless Shutdown gave up
+				s.tasks.wait(s.forceClose)
+			}
+			w, _ := s.wrCounter.addR(-1)
+			if w == 0 {
+				s.doClose()
+			}
+		}()
+
+		var (
+			buff   []byte
+			err    error
+			packet interface{}
+		)
+		for {
+			select {
+			case <-s.die:
+				return
+			case deadline := <-s.recvReq:
+				buff, err = s.socket.Recv(deadline)
+				select {
+				case <-s.die:
+					return
+				default:
+					if nil == err {
+						s.stats.onRead(len(buff))
+						if s.recvLimiter != nil && !s.recvLimiter.wait(len(buff), s.die) {
+							return
+						}
+						packet, err = s.codec.Decode(buff)
+						if s.releasePacket {
+							s.ReleasePacket(buff)
+						}
+						if nil == err {
+							s.stats.onPacketRecv()
+						}
+					}
+					if nil == err && s.onHeartbeat(packet) {
+						if codec, ok := s.codec.(*defaultCodec); ok && codec.zeroCopy {
+							//packet is the buffer,it would be released by the handler otherwise
+							s.ReleasePacket(buff)
+						}
+						//heartbeat doesn't satisfy the recv request
+						select {
+						case s.recvReq <- deadline:
+						default:
+						}
+						continue
+					} else if nil == err {
+						if s.tasks != nil {
+							if !s.submitPacket(packetHandler, packet) {
+								s.close(ErrExecutorStopped, false)
+								return
+							}
+						} else if err = packetHandler(s.context, s, packet); err != nil {
+							s.close(err, false)
+							return
+						}
+					} else if IsNetTimeoutError(err) {
+						s.onRecvTimeout.Load().(func(*AsynSocket))(s)
+					} else {
+						s.close(err, false)
+						return
+					}
+
+					if s.autoRecv {
+						var readdeadline time.Time
+						if s.autoRecvTimeout > 0 {
+							readdeadline = time.Now().Add(s.autoRecvTimeout)
+						}
+						select {
+						case s.recvReq <- readdeadline:
+						default:
+						}
+					}
+				}
+			}
+		}
+	}()
+}
+
+func (s *AsynSocket) sendBuffs(buffs net.Buffers) (err error) {
+	deadline := time.Time{}
+	if s.sendLimiter != nil && !s.sendLimiter.wait(buffsSize(buffs), s.forceClose) {
+		//throttled until Shutdown gave up,drop buffs rather than burst them through the limiter
+		return ErrSocketClosed
+	}
+
+	if s.asyncSendTimeout > 0 {
+		deadline = time.Now().Add(s.asyncSendTimeout)
+	}
+
+	var n int
+	if buffersSender, ok := s.socket.(BuffersSender); ok {
+		var n64 int64
+		n64, err = buffersSender.SendBuffers(buffs, deadline)
+		n = int(n64)
+	} else {
+		outputBuffer := poolbuff.Get()
+		defer poolbuff.Put(outputBuffer)
+		for _, v := range buffs {
+			outputBuffer = append(outputBuffer, v...)
+		}
+		n, err = s.socket.Send(outputBuffer, deadline)
+	}
+
+	s.stats.onWrite(n)
+
+	if nil != err && IsNetTimeoutError(err) {
+		err = ErrAsynSendTimeout
+	}
+
+	return err
+}
+
+func (s *AsynSocket) sendloop() {
+	s.wrCounter.addW(1)
+	go func() {
+		var (
+			err        error
+			inflight   []interface{} //*SharedPacket and *sendRequest in buffs,completed after written
+			halfClosed bool          //write side closed by CloseWrite,recvloop keeps running
+		)
+
+		inflightBytes := 0
+
+		batched := 0 //objects in buffs
+
+		complete := func(err error) {
+			if err == nil {
+				s.stats.onPacketsSent(batched)
+			}
+			batched = 0
+			s.addQueuedBytes(-inflightBytes)
+			inflightBytes = 0
+			for i, v := range inflight {
+				completeSend(v, err)
+				inflight[i] = nil
+			}
+			inflight = inflight[:0]
+		}
+
+		defer func() {
+			complete(ErrSocketClosed)
+			//objects pushed after sendloop exited are completed by the sender,see SendPriority
+			atomic.StoreInt32(&s.sendClosed, 1)
+			s.drainSendReq()
+			_, r := s.wrCounter.addW(-1)
+			if halfClosed {
+				//recvloop may not be started yet,leave doClose to recvloop or Close
+				return
+			} else if r == 0 {
+				s.doClose()
+			} else {
+				//recvloop可能阻塞在s.socket.Recv(deadline),close socket让调用返回错误
+				s.socket.Close()
+			}
+		}()
+
+		maxBuffSize := 1024
+		total := 0
+		n := 0
+		buffs := make(net.Buffers, 0, 8)
+
+		encode := func(o interface{}) {
+			batched++
+			inflightBytes += s.queuedSize(o)
+			req, _ := o.(*sendRequest)
+			if req != nil {
+				inflight = append(inflight, req)
+				o = req.o
+			}
+			if p, ok := o.(*SharedPacket); ok {
+				buffs = append(buffs, p.buff)
+				total += len(p.buff)
+				if req == nil {
+					inflight = append(inflight, p)
+				}
+			} else {
+				buffs, n = s.codec.Encode(buffs, o)
+				total += n
+			}
+		}
+
+		flush := func() bool {
+			err = s.sendBuffs(buffs)
+			complete(err)
+			if nil != err {
+				return false
+			}
+			if cap(buffs) < 64 {
+				for i := 0; i < len(buffs); i++ {
+					buffs[i] = nil
+				}
+				buffs = buffs[:0]
+			} else {
+				buffs = make(net.Buffers, 0, 8)
+			}
+			total = 0
+			return true
+		}
+
+		round := 0
+
+		//flush all queued objects,return false if write failed
+		drain := func() bool {
+			for s.queuedObjects() > 0 {
+				o, _ := s.popSendReq(round)
+				round++
+				encode(o)
+				if total >= MaxSendBlockSize || len(buffs) >= maxBuffSize {
+					if !flush() {
+						return false
+					}
+				}
+			}
+
+			if total > 0 {
+				return flush()
+			}
+			return true
+		}
+
+		for {
+			select {
+			case <-s.die:
+				drain()
+				return
+			case <-s.writeClosed:
+				if drain() {
+					if err = s.socket.(CloseWriter).CloseWrite(); err == nil {
+						halfClosed = true
+						return
+					}
+				}
+				s.close(err, true)
+				return
+			default:
+			}
+
+			o, ok := s.popSendReq(round)
+			if !ok {
+				//all lanes are empty,wait for request
+				select {
+				case <-s.die:
+					continue
+				case <-s.writeClosed:
+					continue
+				case o = <-s.sendReq[PriorityHigh]:
+				case o = <-s.sendReq[PriorityNormal]:
+				case o = <-s.sendReq[PriorityLow]:
+				}
+			}
+			round++
+			encode(o)
+			if (total >= MaxSendBlockSize || len(buffs) >= maxBuffSize) || (total > 0 && s.queuedObjects() == 0) {
+				if !flush() {
+					s.close(err, true)
+					return
+				}
+			}
+		}
+	}()
+}
+
+// number of objects in all lanes
+func (s *AsynSocket) queuedObjects() int {
+	return len(s.sendReq[PriorityHigh]) + len(s.sendReq[PriorityNormal]) + len(s.sendReq[PriorityLow])
+}
+
+// pop an object without blocking,higher lane first.
+//
+// to avoid starvation,the low lane goes first every lowPriorityRound rounds and the normal lane goes first every normalPriorityRound rounds
+func (s *AsynSocket) popSendReq(round int) (interface{}, bool) {
+	var order [priorityCount]Priority
+	if round%lowPriorityRound == lowPriorityRound-1 {
+		order = [priorityCount]Priority{PriorityLow, PriorityNormal, PriorityHigh}
+	} else if round%normalPriorityRound == normalPriorityRound-1 {
+		order = [priorityCount]Priority{PriorityNormal, PriorityHigh, PriorityLow}
+	} else {
+		order = [priorityCount]Priority{PriorityHigh, PriorityNormal, PriorityLow}
+	}
+	for _, prio := range order {
+		select {
+		case o := <-s.sendReq[prio]:
+			return o, true
+		default:
+		}
+	}
+	return nil, false
+}
+
+func (s *AsynSocket) getTimeout(deadline []time.Time) time.Duration {
+	if len(deadline) > 0 {
+		if deadline[0].IsZero() {
+			return -1
+		} else {
+			return time.Until(deadline[0])
+		}
+	} else {
+		return 0
+	}
+}
+
+// deadline: 如果不传递，当发送chan满一直等待
+// deadline.IsZero() || deadline.Before(time.Now):当chan满立即返回ErrSendBusy
+// 否则当发送chan满等待到deadline,返回ErrPushToSendQueueTimeout
+//
+// *SharedPacket is written as is without encoding
+func (s *AsynSocket) Send(o interface{}, deadline ...time.Time) error {
+	return s.SendPriority(o, PriorityNormal, deadline...)
+}
+
+// same as Send,o is pushed to the lane of prio,higher lane is written first
+func (s *AsynSocket) SendPriority(o interface{}, prio Priority, deadline ...time.Time) (err error) {
+	if p, ok := o.(*SharedPacket); ok {
+		p.retain()
+	}
+	if err = s.push(o, prio, deadline); err != nil {
+		completeSend(o, err)
+	}
+	return err
+}
+
+func (s *AsynSocket) push(o interface{}, prio Priority, deadline []time.Time) (err error) {
+	if prio < PriorityLow || prio > PriorityHigh {
+		prio = PriorityNormal
+	}
+	select {
+	case <-s.die:
+		//don't race with sendReq,refuse new objects after closed
+		return ErrSocketClosed
+	case <-s.writeClosed:
+		return ErrWriteClosed
+	default:
+	}
+	size := s.queuedSize(o)
+	s.addQueuedBytes(size)
+	defer func() {
+		if err != nil {
+			s.addQueuedBytes(-size)
+		} else if atomic.LoadInt32(&s.sendClosed) == 1 {
+			//sendloop exited,o would never be sent
+			s.drainSendReq()
+		}
+	}()
+	s.sendOnce.Do(s.sendloop)
+	if timeout := s.getTimeout(deadline); timeout == 0 {
+		//if senReq has no space wait forever
+		select {
+		case <-s.die:
+			return ErrSocketClosed
+		case s.sendReq[prio] <- o:
+			return nil
+		}
+	} else if timeout > 0 {
+		//if sendReq has no space,wait until deadline
+		ticker := time.NewTicker(timeout)
+		defer ticker.Stop()
+		select {
+		case <-s.die:
+			return ErrSocketClosed
+		case <-ticker.C:
+			return ErrPushToSendQueueTimeout
+		case s.sendReq[prio] <- o:
+			return nil
+		}
+	} else {
+		//if sendReq has no space,return busy
+		select {
+		case <-s.die:
+			return ErrSocketClosed
+		case s.sendReq[prio] <- o:
+			return nil
+		default:
+			return ErrSendQueueFull
+		}
+	}
+}
+
+func (s *AsynSocket) SendWithContext(ctx context.Context, o interface{}) (err error) {
+	if p, ok := o.(*SharedPacket); ok {
+		p.retain()
+	}
+	select {
+	case <-s.die:
+		completeSend(o, ErrSocketClosed)
+		return ErrSocketClosed
+	case <-s.writeClosed:
+		completeSend(o, ErrWriteClosed)
+		return ErrWriteClosed
+	default:
+	}
+	size := s.queuedSize(o)
+	s.addQueuedBytes(size)
+	defer func() {
+		if err != nil {
+			s.addQueuedBytes(-size)
+			completeSend(o, err)
+		} else if atomic.LoadInt32(&s.sendClosed) == 1 {
+			s.drainSendReq()
+		}
+	}()
+	s.sendOnce.Do(s.sendloop)
+	select {
+	case <-s.die:
+		return ErrSocketClosed
+	case s.sendReq[PriorityNormal] <- o:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
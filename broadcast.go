@@ -0,0 +1,72 @@
+package netgo
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/sniperHW/netgo/poolbuff"
+)
+
+var (
+	ErrEncodeFailed error = errors.New("encodeFailed")
+)
+
+// object encoded once and sent to many AsynSockets,it is immutable after created
+//
+// SharedPacket is sent by AsynSocket.Send,AsynSocket holds a reference until the packet is written,
+// buffer is given back to poolbuff when the last reference released.
+type SharedPacket struct {
+	buff []byte
+	refs int32
+}
+
+// encode o into a SharedPacket,the caller owns the first reference and should Release it when done
+//
+// codec must be the same framing as the codec of target sockets
+func EncodeShared(codec ObjCodec, o interface{}) (*SharedPacket, error) {
+	buffs, n := codec.Encode(nil, o)
+	if n == 0 {
+		return nil, ErrEncodeFailed
+	}
+	buff := poolbuff.Get()
+	for _, v := range buffs {
+		buff = append(buff, v...)
+	}
+	return &SharedPacket{
+		buff: buff,
+		refs: 1,
+	}, nil
+}
+
+func (p *SharedPacket) Len() int {
+	return len(p.buff)
+}
+
+func (p *SharedPacket) retain() {
+	atomic.AddInt32(&p.refs, 1)
+}
+
+func (p *SharedPacket) Release() {
+	if atomic.AddInt32(&p.refs, -1) == 0 {
+		poolbuff.Put(p.buff)
+		p.buff = nil
+	}
+}
+
+// encode o once and push it to the send queue of each socket without blocking
+//
+// onError is called for each socket failed to push,e.g. ErrSendQueueFull,ErrSocketClosed
+func Broadcast(codec ObjCodec, o interface{}, sockets []*AsynSocket, onError func(*AsynSocket, error)) error {
+	p, err := EncodeShared(codec, o)
+	if err != nil {
+		return err
+	}
+	defer p.Release()
+	for _, s := range sockets {
+		if err = s.Send(p, time.Time{}); err != nil && onError != nil {
+			onError(s, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package netgo
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"net"
+	"time"
+)
+
+var (
+	ErrChecksumMismatch error = errors.New("checksumMismatch")
+)
+
+// size of the checksum in front of the payload
+const ChecksumSize int = 4
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// PacketReceiver verifies packets like [crc32c:4][payload]
+//
+// framing is done by the inner PacketReceiver,the returned packet is payload only.
+// ErrChecksumMismatch is returned when verify failed.
+type ChecksumReceiver struct {
+	receiver PacketReceiver
+}
+
+func NewChecksumReceiver(receiver PacketReceiver) *ChecksumReceiver {
+	if receiver == nil {
+		receiver = NewLengthPrefixReceiver(LengthPrefixOption{})
+	}
+	return &ChecksumReceiver{
+		receiver: receiver,
+	}
+}
+
+func (cr *ChecksumReceiver) Recv(readable ReadAble, deadline time.Time) ([]byte, error) {
+	packet, err := cr.receiver.Recv(readable, deadline)
+	if err != nil {
+		return nil, err
+	} else if len(packet) < ChecksumSize {
+		return nil, ErrInvalidPacketLength
+	} else if binary.BigEndian.Uint32(packet) != crc32.Checksum(packet[ChecksumSize:], castagnoliTable) {
+		return nil, ErrChecksumMismatch
+	} else {
+		return packet[ChecksumSize:], nil
+	}
+}
+
+// append crc32c of payload and the payload,return buffs and the appended size
+//
+// helper for ObjCodec.Encode,frame header should count ChecksumSize,e.g.
+//
+//	buffs, n := receiver.AppendHeader(buffs, len(payload)+ChecksumSize)
+//	buffs, m := AppendChecksum(buffs, payload)
+func AppendChecksum(buffs net.Buffers, payload ...[]byte) (net.Buffers, int) {
+	var crc uint32
+	size := ChecksumSize
+	for _, v := range payload {
+		crc = crc32.Update(crc, castagnoliTable, v)
+		size += len(v)
+	}
+	b := make([]byte, ChecksumSize)
+	binary.BigEndian.PutUint32(b, crc)
+	buffs = append(buffs, b)
+	return append(buffs, payload...), size
+}
@@ -0,0 +1,72 @@
+package netgo
+
+import (
+	"bytes"
+	"time"
+)
+
+type DelimiterOption struct {
+	Delimiter      []byte //default "\n"
+	MaxLength      int    //max length of a packet(delimiter excluded),default 4096
+	StripDelimiter bool   //remove delimiter from the returned packet
+}
+
+// PacketReceiver for text protocols,split the stream by delimiter such as "\n","\r\n" or "\x00"
+//
+// the returned packet refers to the receiver's internal buffer,it is valid until the next call of Recv.
+type DelimiterReceiver struct {
+	recvBuff
+	delimiter      []byte
+	maxLength      int
+	stripDelimiter bool
+	scanned        int //bytes from r that have been searched without finding a delimiter
+}
+
+func NewDelimiterReceiver(option DelimiterOption) *DelimiterReceiver {
+	if len(option.Delimiter) == 0 {
+		option.Delimiter = []byte("\n")
+	}
+
+	if option.MaxLength <= 0 {
+		option.MaxLength = 4096
+	}
+
+	return &DelimiterReceiver{
+		delimiter:      append([]byte{}, option.Delimiter...),
+		maxLength:      option.MaxLength,
+		stripDelimiter: option.StripDelimiter,
+	}
+}
+
+func (dr *DelimiterReceiver) Recv(readable ReadAble, deadline time.Time) ([]byte, error) {
+	for {
+		buffered := dr.buffered()
+		if i := bytes.Index(buffered[dr.scanned:], dr.delimiter); i >= 0 {
+			end := dr.scanned + i
+			if end > dr.maxLength {
+				return nil, &PacketTooLargeError{Size: uint64(end), MaxSize: dr.maxLength}
+			}
+			size := end + len(dr.delimiter)
+			dr.scanned = 0
+			dr.skip(size)
+			if dr.stripDelimiter {
+				return buffered[:end], nil
+			} else {
+				return buffered[:size], nil
+			}
+		}
+
+		if len(buffered) > dr.maxLength+len(dr.delimiter)-1 {
+			return nil, &PacketTooLargeError{Size: uint64(len(buffered)), MaxSize: dr.maxLength}
+		}
+
+		//a delimiter may split across two reads,search again from the last partial match position
+		if dr.scanned = len(buffered) - len(dr.delimiter) + 1; dr.scanned < 0 {
+			dr.scanned = 0
+		}
+
+		if err := dr.fill(readable, deadline, len(buffered)+1); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package netgo
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+)
+
+var (
+	ErrExecutorStopped error = errors.New("executorStopped")
+)
+
+type ExecutorOption struct {
+	Workers   int //max handlers running concurrently,default runtime.NumCPU()
+	QueueSize int //max pending handlers of all sockets,recvloop waits when full,default 65536
+}
+
+// bounded worker pool shared by many AsynSockets to run packet handlers
+//
+// handlers of the same socket are run one by one in the received order,
+// a slow handler only delays its own socket.
+type Executor struct {
+	slots     chan struct{} //one slot for each pending handler
+	ready     chan *taskQueue
+	die       chan struct{}
+	closeOnce sync.Once
+}
+
+func NewExecutor(option ExecutorOption) *Executor {
+	if option.Workers <= 0 {
+		option.Workers = runtime.NumCPU()
+	}
+
+	if option.QueueSize <= 0 {
+		option.QueueSize = 65536
+	}
+
+	e := &Executor{
+		slots: make(chan struct{}, option.QueueSize),
+		//every queue in ready holds at least one slot,so push to ready never blocks
+		ready: make(chan *taskQueue, option.QueueSize),
+		die:   make(chan struct{}),
+	}
+
+	for i := 0; i < option.Workers; i++ {
+		go e.work()
+	}
+
+	return e
+}
+
+// stop workers,pending handlers are dropped
+func (e *Executor) Stop() {
+	e.closeOnce.Do(func() {
+		close(e.die)
+	})
+}
+
+func (e *Executor) work() {
+	for {
+		select {
+		case <-e.die:
+			return
+		case q := <-e.ready:
+			q.runOne()
+		}
+	}
+}
+
+// handlers of one socket
+type taskQueue struct {
+	executor  *Executor
+	mu        sync.Mutex
+	tasks     []func()
+	scheduled bool          //in ready or running
+	done      chan struct{} //notified after a handler returned
+}
+
+func newTaskQueue(e *Executor) *taskQueue {
+	return &taskQueue{
+		executor: e,
+		done:     make(chan struct{}, 1),
+	}
+}
+
+// return false if cancel closed or executor stopped while waiting for a slot
+func (q *taskQueue) submit(task func(), cancel <-chan struct{}) bool {
+	select {
+	case q.executor.slots <- struct{}{}:
+	case <-cancel:
+		return false
+	case <-q.executor.die:
+		return false
+	}
+
+	q.mu.Lock()
+	q.tasks = append(q.tasks, task)
+	schedule := !q.scheduled
+	q.scheduled = true
+	q.mu.Unlock()
+
+	if schedule {
+		q.executor.ready <- q
+	}
+	return true
+}
+
+// run the first task,requeue if there is more,so sockets share workers fairly
+func (q *taskQueue) runOne() {
+	q.mu.Lock()
+	task := q.tasks[0]
+	q.tasks[0] = nil
+	q.tasks = q.tasks[1:]
+	q.mu.Unlock()
+
+	task()
+	<-q.executor.slots
+
+	q.mu.Lock()
+	more := len(q.tasks) > 0
+	q.scheduled = more
+	q.mu.Unlock()
+
+	select {
+	case q.done <- struct{}{}:
+	default:
+	}
+
+	if more {
+		q.executor.ready <- q
+	}
+}
+
+// number of handlers submitted but not returned
+func (q *taskQueue) pending() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := len(q.tasks)
+	if q.scheduled {
+		//the running one has been removed from tasks
+		n++
+	}
+	return n
+}
+
+// wait until all submitted handlers returned,executor stopped or cancel closed
+func (q *taskQueue) wait(cancel <-chan struct{}) {
+	for q.pending() > 0 {
+		select {
+		case <-q.done:
+		case <-q.executor.die:
+			return
+		case <-cancel:
+			return
+		}
+	}
+}
+
+// run packet handler on executor,return false if socket closed or executor stopped
+//
+// a submitted handler is always run,even if the socket is closed before it starts
+func (s *AsynSocket) submitPacket(packetHandler func(context.Context, *AsynSocket, interface{}) error, packet interface{}) bool {
+	ok := s.tasks.submit(func() {
+		if err := packetHandler(s.context, s, packet); err != nil {
+			//recvloop may be blocked in Recv,Close unblocks it
+			s.Close(err)
+		}
+	}, s.die)
+
+	//pause reading while too many handlers pending
+	for ok && s.tasks.pending() >= s.maxPendingTasks {
+		select {
+		case <-s.tasks.done:
+		case <-s.die:
+			ok = false
+		case <-s.tasks.executor.die:
+			ok = false
+		}
+	}
+	return ok
+}
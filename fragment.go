@@ -0,0 +1,206 @@
+package netgo
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrReassembleTimeout error = errors.New("reassembleTimeout")
+	ErrInvalidFragment   error = errors.New("invalidFragment")
+)
+
+const (
+	fragmentFlag       uint32 = 1 << 31
+	fragmentHeaderSize int    = 8 //[msgID:4][totalSize:4]
+)
+
+type FragmentOption struct {
+	Codec             ObjCodec      //codec of the message payload,default codec for []byte if nil
+	FragmentSize      int           //max payload size of a frame,larger message is fragmented,default 4096
+	MaxMessageSize    int           //max size of a reassembled message,default 16MB
+	ReassembleTimeout time.Duration //max duration between the first fragment and the last fragment of a message,0 means no limit
+}
+
+type reassembly struct {
+	msgID     uint32
+	totalSize int
+	buff      []byte
+	deadline  time.Time
+}
+
+// codec/receiver pair split large message into fragments and reassemble them on receipt
+//
+// message not larger than FragmentSize is sent as [len:4][payload],the same as LengthPrefixReceiver.
+//
+// larger message is sent as fragments [len|1<<31:4][msgID:4][totalSize:4][chunk],fragments of a message are in order.
+//
+// FragmentCodec keeps receiving state,one codec per socket.
+// fragments of different messages are never interleaved,so only one message is reassembled at a time.
+type FragmentCodec struct {
+	recvBuff
+	codec             ObjCodec
+	fragmentSize      int
+	maxMessageSize    int
+	reassembleTimeout time.Duration
+	nextMsgID         uint32
+	pending           *reassembly
+}
+
+func NewFragmentCodec(option FragmentOption) *FragmentCodec {
+	if option.Codec == nil {
+		option.Codec = &defaultCodec{}
+	}
+
+	if option.FragmentSize <= 0 {
+		option.FragmentSize = 4096
+	}
+
+	if option.MaxMessageSize <= 0 {
+		option.MaxMessageSize = 16 * 1024 * 1024
+	}
+
+	return &FragmentCodec{
+		codec:             option.Codec,
+		fragmentSize:      option.FragmentSize,
+		maxMessageSize:    option.MaxMessageSize,
+		reassembleTimeout: option.ReassembleTimeout,
+	}
+}
+
+func (fc *FragmentCodec) Encode(buffs net.Buffers, o interface{}) (net.Buffers, int) {
+	payload, n := fc.codec.Encode(nil, o)
+	if n == 0 {
+		return buffs, 0
+	} else if n <= fc.fragmentSize {
+		header := make([]byte, 4)
+		binary.BigEndian.PutUint32(header, uint32(n))
+		return append(append(buffs, header), payload...), n + 4
+	}
+
+	msgID := atomic.AddUint32(&fc.nextMsgID, 1)
+	msgSize := uint32(n)
+	total := 0
+	for n > 0 {
+		chunkSize := fc.fragmentSize
+		if chunkSize > n {
+			chunkSize = n
+		}
+		header := make([]byte, 4+fragmentHeaderSize)
+		binary.BigEndian.PutUint32(header, uint32(fragmentHeaderSize+chunkSize)|fragmentFlag)
+		binary.BigEndian.PutUint32(header[4:], msgID)
+		binary.BigEndian.PutUint32(header[8:], msgSize)
+		buffs = append(buffs, header)
+		total += len(header) + chunkSize
+		n -= chunkSize
+		//move chunkSize bytes from payload to buffs
+		for chunkSize > 0 {
+			if len(payload[0]) <= chunkSize {
+				chunkSize -= len(payload[0])
+				buffs = append(buffs, payload[0])
+				payload = payload[1:]
+			} else {
+				buffs = append(buffs, payload[0][:chunkSize])
+				payload[0] = payload[0][chunkSize:]
+				chunkSize = 0
+			}
+		}
+	}
+	return buffs, total
+}
+
+func (fc *FragmentCodec) Decode(b []byte) (interface{}, error) {
+	return fc.codec.Decode(b)
+}
+
+// add a fragment,return the message when all fragments are received
+func (fc *FragmentCodec) reassemble(fragment []byte) ([]byte, error) {
+	if len(fragment) < fragmentHeaderSize {
+		return nil, ErrInvalidFragment
+	}
+	msgID := binary.BigEndian.Uint32(fragment)
+	totalSize := int(binary.BigEndian.Uint32(fragment[4:]))
+	chunk := fragment[fragmentHeaderSize:]
+	r := fc.pending
+	if r == nil {
+		if totalSize > fc.maxMessageSize {
+			return nil, &PacketTooLargeError{Size: uint64(totalSize), MaxSize: fc.maxMessageSize}
+		}
+		//buffer grows as chunks arrive,a peer couldn't make us allocate totalSize by a tiny fragment
+		r = &reassembly{
+			msgID:     msgID,
+			totalSize: totalSize,
+		}
+		if fc.reassembleTimeout > 0 {
+			r.deadline = time.Now().Add(fc.reassembleTimeout)
+		}
+		fc.pending = r
+	} else if r.msgID != msgID {
+		//the previous message is not finished
+		return nil, ErrInvalidFragment
+	}
+
+	if totalSize != r.totalSize || len(r.buff)+len(chunk) > r.totalSize {
+		return nil, ErrInvalidFragment
+	}
+
+	r.buff = append(r.buff, chunk...)
+	if len(r.buff) == r.totalSize {
+		fc.pending = nil
+		return r.buff, nil
+	} else {
+		return nil, nil
+	}
+}
+
+// the returned packet refers to the receiver's internal buffer unless it is a reassembled message,
+// it is valid until the next call of Recv.
+func (fc *FragmentCodec) Recv(readable ReadAble, deadline time.Time) ([]byte, error) {
+	for {
+		//read deadline is clamped to the deadline of the message being reassembled
+		readDeadline := deadline
+		reassembling := fc.pending != nil && fc.reassembleTimeout > 0
+		if reassembling {
+			if !time.Now().Before(fc.pending.deadline) {
+				return nil, ErrReassembleTimeout
+			} else if readDeadline.IsZero() || fc.pending.deadline.Before(readDeadline) {
+				readDeadline = fc.pending.deadline
+			}
+		}
+
+		buffered := fc.buffered()
+		need := 4
+		if len(buffered) >= 4 {
+			header := binary.BigEndian.Uint32(buffered)
+			size := int(header &^ fragmentFlag)
+			maxSize := fc.fragmentSize
+			if header&fragmentFlag != 0 {
+				maxSize += fragmentHeaderSize
+			}
+			if size > maxSize {
+				return nil, &PacketTooLargeError{Size: uint64(size), MaxSize: maxSize}
+			}
+			need += size
+			if len(buffered) >= need {
+				fc.skip(need)
+				if header&fragmentFlag == 0 {
+					return buffered[4:need], nil
+				} else if packet, err := fc.reassemble(buffered[4:need]); err != nil || packet != nil {
+					return packet, err
+				} else {
+					continue
+				}
+			}
+		}
+
+		if err := fc.fill(readable, readDeadline, need); err != nil {
+			if reassembling && IsNetTimeoutError(err) && !time.Now().Before(fc.pending.deadline) {
+				return nil, ErrReassembleTimeout
+			}
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package netgo
+
+import (
+	"sync"
+	"time"
+)
+
+const groupShards = 64
+
+type groupShard struct {
+	sync.RWMutex
+	members map[*AsynSocket]uint64 //socket -> id of close listener
+}
+
+// set of AsynSockets,e.g. a room or a channel
+//
+// member is removed automatically after the socket closed,the close callback of the socket is kept.
+// Group is safe for concurrent use,members are spread over shards to reduce lock contention.
+type Group struct {
+	codec  ObjCodec
+	shards [groupShards]groupShard
+}
+
+// codec encodes broadcast objects once for all members,it must have the same framing as codec of members,
+// []byte is sent as is if codec is nil
+func NewGroup(codec ObjCodec) *Group {
+	if codec == nil {
+		codec = &defaultCodec{}
+	}
+	g := &Group{codec: codec}
+	for i := range g.shards {
+		g.shards[i].members = map[*AsynSocket]uint64{}
+	}
+	return g
+}
+
+func (g *Group) shard(s *AsynSocket) *groupShard {
+	return &g.shards[s.id%groupShards]
+}
+
+// return false if s is already a member or closed
+func (g *Group) Add(s *AsynSocket) bool {
+	shard := g.shard(s)
+	shard.Lock()
+	if _, ok := shard.members[s]; ok {
+		shard.Unlock()
+		return false
+	}
+	shard.members[s] = 0
+	shard.Unlock()
+
+	id, ok := s.addCloseListener(func(s *AsynSocket, _ error) {
+		g.remove(s)
+	})
+
+	if !ok {
+		g.remove(s)
+		return false
+	}
+
+	shard.Lock()
+	if _, ok = shard.members[s]; ok {
+		shard.members[s] = id
+	}
+	shard.Unlock()
+
+	if !ok {
+		//removed before the listener attached
+		s.removeCloseListener(id)
+	}
+	return true
+}
+
+func (g *Group) remove(s *AsynSocket) (uint64, bool) {
+	shard := g.shard(s)
+	shard.Lock()
+	id, ok := shard.members[s]
+	if ok {
+		delete(shard.members, s)
+	}
+	shard.Unlock()
+	return id, ok
+}
+
+// return false if s is not a member
+func (g *Group) Remove(s *AsynSocket) bool {
+	if id, ok := g.remove(s); ok {
+		s.removeCloseListener(id)
+		return true
+	}
+	return false
+}
+
+func (g *Group) Contains(s *AsynSocket) bool {
+	shard := g.shard(s)
+	shard.RLock()
+	_, ok := shard.members[s]
+	shard.RUnlock()
+	return ok
+}
+
+func (g *Group) Len() int {
+	n := 0
+	for i := range g.shards {
+		g.shards[i].RLock()
+		n += len(g.shards[i].members)
+		g.shards[i].RUnlock()
+	}
+	return n
+}
+
+// call fn for each member until fn returns false,fn is called without lock held,members added during Range may not be visited
+func (g *Group) Range(fn func(*AsynSocket) bool) {
+	var members []*AsynSocket
+	for i := range g.shards {
+		shard := &g.shards[i]
+		shard.RLock()
+		members = members[:0]
+		for s := range shard.members {
+			members = append(members, s)
+		}
+		shard.RUnlock()
+		for _, s := range members {
+			if !fn(s) {
+				return
+			}
+		}
+	}
+}
+
+// encode o once and push it to all members without blocking,see Broadcast
+func (g *Group) Broadcast(o interface{}, onError func(*AsynSocket, error)) error {
+	return g.BroadcastFilter(o, nil, onError)
+}
+
+// same as Broadcast,but only to members filter returns true
+func (g *Group) BroadcastFilter(o interface{}, filter func(*AsynSocket) bool, onError func(*AsynSocket, error)) error {
+	p, err := EncodeShared(g.codec, o)
+	if err != nil {
+		return err
+	}
+	defer p.Release()
+	g.Range(func(s *AsynSocket) bool {
+		if filter == nil || filter(s) {
+			if err := s.Send(p, time.Time{}); err != nil && onError != nil {
+				onError(s, err)
+			}
+		}
+		return true
+	})
+	return nil
+}
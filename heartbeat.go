@@ -0,0 +1,185 @@
+package netgo
+
+import (
+	"bytes"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrHeartbeatTimeout error = errors.New("heartbeatTimeout")
+)
+
+// ping/pong message pair of AsynSocket heartbeat,messages are the decoded objects of codec
+type Heartbeat interface {
+	Ping() interface{}
+	IsPing(interface{}) bool
+	Pong(ping interface{}) interface{}
+	IsPong(interface{}) bool
+}
+
+// Heartbeat for codecs decoding packet to []byte,e.g. the default codec
+type BytesHeartbeat struct {
+	PingPacket []byte
+	PongPacket []byte
+}
+
+func (h *BytesHeartbeat) Ping() interface{} {
+	return h.PingPacket
+}
+
+func (h *BytesHeartbeat) IsPing(o interface{}) bool {
+	b, ok := o.([]byte)
+	return ok && bytes.Equal(b, h.PingPacket)
+}
+
+func (h *BytesHeartbeat) Pong(interface{}) interface{} {
+	return h.PongPacket
+}
+
+func (h *BytesHeartbeat) IsPong(o interface{}) bool {
+	b, ok := o.([]byte)
+	return ok && bytes.Equal(b, h.PongPacket)
+}
+
+type heartbeat struct {
+	Heartbeat
+	pingInterval     time.Duration
+	idleReadTimeout  time.Duration
+	idleWriteTimeout time.Duration
+	pingSent         int64 //unix nano of the ping waiting for pong,0 if none
+	intervalPingSent int64 //unix nano of the PingInterval ping waiting for pong,0 if none
+	rtt              int64
+}
+
+func newHeartbeat(option AsynSocketOption) *heartbeat {
+	if option.IdleReadTimeout <= 0 && option.Heartbeat == nil {
+		return nil
+	}
+	return &heartbeat{
+		Heartbeat:        option.Heartbeat,
+		pingInterval:     option.PingInterval,
+		idleReadTimeout:  option.IdleReadTimeout,
+		idleWriteTimeout: option.IdleWriteTimeout,
+	}
+}
+
+// round-trip time of the last ping/pong,0 if no pong received yet
+func (s *AsynSocket) RTT() time.Duration {
+	if s.heartbeat == nil {
+		return 0
+	}
+	return time.Duration(atomic.LoadInt64(&s.heartbeat.rtt))
+}
+
+// consume ping/pong,return true if packet is a heartbeat message
+func (s *AsynSocket) onHeartbeat(packet interface{}) bool {
+	h := s.heartbeat
+	if h == nil || h.Heartbeat == nil {
+		return false
+	} else if h.IsPing(packet) {
+		s.SendPriority(h.Pong(packet), PriorityHigh, time.Time{})
+		return true
+	} else if h.IsPong(packet) {
+		if sent := atomic.SwapInt64(&h.pingSent, 0); sent != 0 {
+			atomic.StoreInt64(&h.rtt, time.Now().UnixNano()-sent)
+		}
+		atomic.StoreInt64(&h.intervalPingSent, 0)
+		return true
+	} else {
+		return false
+	}
+}
+
+func (s *AsynSocket) ping(interval bool) {
+	now := time.Now().UnixNano()
+	atomic.CompareAndSwapInt64(&s.heartbeat.pingSent, 0, now)
+	if interval {
+		atomic.CompareAndSwapInt64(&s.heartbeat.intervalPingSent, 0, now)
+	}
+	s.SendPriority(s.heartbeat.Ping(), PriorityHigh, time.Time{})
+}
+
+// run fn after d,fn returns the delay of the next run,stop when fn returns 0 or socket closed
+func (s *AsynSocket) runTimer(d time.Duration, fn func() time.Duration) {
+	time.AfterFunc(d, func() {
+		select {
+		case <-s.die:
+		default:
+			if next := fn(); next > 0 {
+				s.runTimer(next, fn)
+			}
+		}
+	})
+}
+
+// return remaining time before idle timeout,0 if timeout,idle time is counted from created if never read/write
+func (s *AsynSocket) idleRemain(last *int64, timeout time.Duration) time.Duration {
+	since := atomic.LoadInt64(last)
+	if since == 0 {
+		since = s.stats.created
+	}
+	elapsed := time.Duration(time.Now().UnixNano() - since)
+	if elapsed >= timeout {
+		return 0
+	}
+	return timeout - elapsed
+}
+
+func (s *AsynSocket) startHeartbeat() {
+	h := s.heartbeat
+	if h == nil {
+		return
+	}
+
+	if h.idleReadTimeout > 0 {
+		s.runTimer(h.idleReadTimeout, func() time.Duration {
+			remain := s.idleRemain(&s.stats.lastRead, h.idleReadTimeout)
+			if remain == 0 {
+				s.Close(ErrHeartbeatTimeout)
+			}
+			return remain
+		})
+	}
+
+	if h.Heartbeat == nil {
+		return
+	}
+
+	if h.idleWriteTimeout > 0 {
+		s.runTimer(h.idleWriteTimeout, func() time.Duration {
+			if s.isWriteClosed() {
+				//ping can't be sent after CloseWrite
+				return 0
+			}
+			remain := s.idleRemain(&s.stats.lastWrite, h.idleWriteTimeout)
+			if remain == 0 {
+				s.ping(false)
+				return h.idleWriteTimeout
+			}
+			return remain
+		})
+	}
+
+	if h.pingInterval > 0 {
+		s.runTimer(h.pingInterval, func() time.Duration {
+			if s.isWriteClosed() {
+				//waiting for EOF of the peer,IdleReadTimeout still works
+				return 0
+			}
+			if sent := atomic.LoadInt64(&h.intervalPingSent); sent != 0 {
+				//only the interval ping outstanding for a full PingInterval times out,
+				//an idle write ping sent just before is not
+				if outstanding := time.Duration(time.Now().UnixNano() - sent); outstanding >= h.pingInterval {
+					s.Close(ErrHeartbeatTimeout)
+					return 0
+				} else {
+					return h.pingInterval - outstanding
+				}
+			}
+			s.ping(true)
+			return h.pingInterval
+		})
+	}
+}
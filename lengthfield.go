@@ -0,0 +1,111 @@
+package netgo
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// options of LengthFieldReceiver,the same as netty's LengthFieldBasedFrameDecoder
+//
+// frame length = LengthFieldOffset + LengthFieldLength + value of length field + LengthAdjustment
+type LengthFieldOption struct {
+	LengthFieldOffset   int              //offset of the length field
+	LengthFieldLength   int              //size of the length field,must be 1,2,3,4 or 8,default 4
+	LengthAdjustment    int              //compensation added to the value of the length field
+	InitialBytesToStrip int              //number of bytes stripped from the head of the decoded frame
+	MaxFrameLength      int              //max length of frame,default 65535
+	ByteOrder           binary.ByteOrder //default binary.BigEndian
+}
+
+// PacketReceiver for binary protocols with a length field in header,e.g. [magic:2][type:1][len:4][body]
+//
+// the returned packet refers to the receiver's internal buffer,it is valid until the next call of Recv.
+type LengthFieldReceiver struct {
+	recvBuff
+	option LengthFieldOption
+}
+
+func NewLengthFieldReceiver(option LengthFieldOption) *LengthFieldReceiver {
+	switch option.LengthFieldLength {
+	case 0:
+		option.LengthFieldLength = 4
+	case 1, 2, 3, 4, 8:
+	default:
+		panic(fmt.Sprintf("netgo: invalid LengthFieldLength %d", option.LengthFieldLength))
+	}
+
+	if option.LengthFieldOffset < 0 || option.InitialBytesToStrip < 0 {
+		panic("netgo: negative LengthFieldOffset or InitialBytesToStrip")
+	}
+
+	if option.MaxFrameLength <= 0 {
+		option.MaxFrameLength = 65535
+	}
+
+	if option.ByteOrder == nil {
+		option.ByteOrder = binary.BigEndian
+	}
+
+	return &LengthFieldReceiver{
+		option: option,
+	}
+}
+
+func (lr *LengthFieldReceiver) getLength(b []byte) uint64 {
+	switch lr.option.LengthFieldLength {
+	case 1:
+		return uint64(b[0])
+	case 2:
+		return uint64(lr.option.ByteOrder.Uint16(b))
+	case 3:
+		if lr.option.ByteOrder == binary.LittleEndian {
+			return uint64(b[0]) | uint64(b[1])<<8 | uint64(b[2])<<16
+		} else {
+			return uint64(b[2]) | uint64(b[1])<<8 | uint64(b[0])<<16
+		}
+	case 4:
+		return uint64(lr.option.ByteOrder.Uint32(b))
+	default:
+		return lr.option.ByteOrder.Uint64(b)
+	}
+}
+
+// parse header,return length of the whole frame
+func (lr *LengthFieldReceiver) frameLength(buffered []byte) (int, error) {
+	lengthFieldEnd := lr.option.LengthFieldOffset + lr.option.LengthFieldLength
+	l := lr.getLength(buffered[lr.option.LengthFieldOffset:lengthFieldEnd])
+	if l > uint64(lr.option.MaxFrameLength) {
+		return 0, &PacketTooLargeError{Size: l, MaxSize: lr.option.MaxFrameLength}
+	}
+
+	frameLength := int(l) + lr.option.LengthAdjustment + lengthFieldEnd
+	if frameLength < lengthFieldEnd || frameLength < lr.option.InitialBytesToStrip {
+		return 0, ErrInvalidPacketLength
+	} else if frameLength > lr.option.MaxFrameLength {
+		return 0, &PacketTooLargeError{Size: uint64(frameLength), MaxSize: lr.option.MaxFrameLength}
+	}
+	return frameLength, nil
+}
+
+func (lr *LengthFieldReceiver) Recv(readable ReadAble, deadline time.Time) ([]byte, error) {
+	for {
+		buffered := lr.buffered()
+		need := lr.option.LengthFieldOffset + lr.option.LengthFieldLength
+		if len(buffered) >= need {
+			frameLength, err := lr.frameLength(buffered)
+			if err != nil {
+				return nil, err
+			}
+			need = frameLength
+			if len(buffered) >= need {
+				lr.skip(need)
+				return buffered[lr.option.InitialBytesToStrip:need], nil
+			}
+		}
+
+		if err := lr.fill(readable, deadline, need); err != nil {
+			return nil, err
+		}
+	}
+}
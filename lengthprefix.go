@@ -0,0 +1,242 @@
+package netgo
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"time"
+)
+
+var (
+	ErrInvalidPacketLength error = errors.New("invalidPacketLength")
+)
+
+// returned by framing PacketReceivers when the peer announces a packet larger than the limit
+type PacketTooLargeError struct {
+	Size    uint64
+	MaxSize int
+}
+
+func (e *PacketTooLargeError) Error() string {
+	return fmt.Sprintf("packet too large:%d,max:%d", e.Size, e.MaxSize)
+}
+
+type LengthPrefixOption struct {
+	HeaderSize     int              //size of the length header,must be 1,2,4 or 8,default 4
+	ByteOrder      binary.ByteOrder //default binary.BigEndian
+	MaxPacketSize  int              //max size of packet(header excluded),default 65535,AppendHeader refuses larger packets too
+	HeaderIncluded bool             //length in header counts the header itself
+}
+
+// PacketReceiver for packets like [length][payload]
+//
+// the returned packet is payload only and refers to the receiver's internal buffer,
+// it is valid until the next call of Recv.
+//
+// LengthPrefixReceiver keeps receiving state,one receiver per socket.
+type LengthPrefixReceiver struct {
+	recvBuff
+	headerSize     int
+	byteOrder      binary.ByteOrder
+	maxPacketSize  int
+	headerIncluded bool
+}
+
+func NewLengthPrefixReceiver(option LengthPrefixOption) *LengthPrefixReceiver {
+	switch option.HeaderSize {
+	case 0:
+		option.HeaderSize = 4
+	case 1, 2, 4, 8:
+	default:
+		panic(fmt.Sprintf("netgo: invalid HeaderSize %d", option.HeaderSize))
+	}
+
+	if option.ByteOrder == nil {
+		option.ByteOrder = binary.BigEndian
+	}
+
+	if option.MaxPacketSize <= 0 {
+		option.MaxPacketSize = 65535
+	}
+
+	return &LengthPrefixReceiver{
+		headerSize:     option.HeaderSize,
+		byteOrder:      option.ByteOrder,
+		maxPacketSize:  option.MaxPacketSize,
+		headerIncluded: option.HeaderIncluded,
+	}
+}
+
+func (lr *LengthPrefixReceiver) getLength(b []byte) uint64 {
+	switch lr.headerSize {
+	case 1:
+		return uint64(b[0])
+	case 2:
+		return uint64(lr.byteOrder.Uint16(b))
+	case 4:
+		return uint64(lr.byteOrder.Uint32(b))
+	default:
+		return lr.byteOrder.Uint64(b)
+	}
+}
+
+func (lr *LengthPrefixReceiver) putLength(b []byte, l uint64) {
+	switch lr.headerSize {
+	case 1:
+		b[0] = byte(l)
+	case 2:
+		lr.byteOrder.PutUint16(b, uint16(l))
+	case 4:
+		lr.byteOrder.PutUint32(b, uint32(l))
+	default:
+		lr.byteOrder.PutUint64(b, l)
+	}
+}
+
+// parse header,return size of payload
+func (lr *LengthPrefixReceiver) payloadSize(header []byte) (int, error) {
+	l := lr.getLength(header)
+	if lr.headerIncluded {
+		if l < uint64(lr.headerSize) {
+			return 0, ErrInvalidPacketLength
+		}
+		l -= uint64(lr.headerSize)
+	}
+	if l > uint64(lr.maxPacketSize) {
+		return 0, &PacketTooLargeError{Size: l, MaxSize: lr.maxPacketSize}
+	}
+	return int(l), nil
+}
+
+// max length the header can hold
+func (lr *LengthPrefixReceiver) maxLength() uint64 {
+	switch lr.headerSize {
+	case 1:
+		return math.MaxUint8
+	case 2:
+		return math.MaxUint16
+	case 4:
+		return math.MaxUint32
+	default:
+		return math.MaxUint64
+	}
+}
+
+// append header for a payload of size bytes,return buffs and size of header
+//
+// if size exceeds MaxPacketSize or the header can't hold it,buffs is returned unchanged with 0,
+// the caller mustn't send the payload.
+func (lr *LengthPrefixReceiver) AppendHeader(buffs net.Buffers, size int) (net.Buffers, int) {
+	if size < 0 || size > lr.maxPacketSize {
+		return buffs, 0
+	}
+	l := uint64(size)
+	if lr.headerIncluded {
+		l += uint64(lr.headerSize)
+	}
+	if l > lr.maxLength() {
+		return buffs, 0
+	}
+	header := make([]byte, lr.headerSize)
+	lr.putLength(header, l)
+	return append(buffs, header), lr.headerSize
+}
+
+func (lr *LengthPrefixReceiver) Recv(readable ReadAble, deadline time.Time) ([]byte, error) {
+	for {
+		buffered := lr.buffered()
+		need := lr.headerSize
+		if len(buffered) >= lr.headerSize {
+			size, err := lr.payloadSize(buffered)
+			if err != nil {
+				return nil, err
+			}
+			need += size
+			if len(buffered) >= need {
+				lr.skip(need)
+				return buffered[lr.headerSize:need], nil
+			}
+		}
+
+		if err := lr.fill(readable, deadline, need); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// reader of a frame,buffered data is read first then read from the underlying conn
+type frameReader struct {
+	rb       *recvBuff
+	readable ReadAble
+	remain   int
+}
+
+func (fr *frameReader) Read(b []byte) (n int, err error) {
+	if fr.remain == 0 {
+		return 0, io.EOF
+	}
+
+	if len(b) > fr.remain {
+		b = b[:fr.remain]
+	}
+
+	if buffered := fr.rb.buffered(); len(buffered) > 0 {
+		n = copy(b, buffered)
+		fr.rb.skip(n)
+	} else {
+		n, err = fr.readable.Read(b)
+	}
+
+	fr.remain -= n
+	if err == io.EOF && fr.remain > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// discard the rest of the frame
+func (fr *frameReader) Close() error {
+	_, err := io.Copy(io.Discard, fr)
+	return err
+}
+
+// receive a packet as a stream,size of the packet is not limited by MaxPacketSize
+func (lr *LengthPrefixReceiver) RecvStream(readable ReadAble, deadline time.Time, handler func(io.Reader) error) error {
+	for len(lr.buffered()) < lr.headerSize {
+		if err := lr.fill(readable, deadline, lr.headerSize); err != nil {
+			return err
+		}
+	}
+
+	l := lr.getLength(lr.buffered())
+	if lr.headerIncluded {
+		if l < uint64(lr.headerSize) {
+			return ErrInvalidPacketLength
+		}
+		l -= uint64(lr.headerSize)
+	}
+
+	if l > uint64(int(^uint(0)>>1)) {
+		return &PacketTooLargeError{Size: l, MaxSize: int(^uint(0) >> 1)}
+	}
+
+	if err := readable.SetReadDeadline(deadline); err != nil {
+		return err
+	}
+
+	lr.skip(lr.headerSize)
+	fr := &frameReader{
+		rb:       &lr.recvBuff,
+		readable: readable,
+		remain:   int(l),
+	}
+
+	if err := handler(fr); err != nil {
+		//the rest of the frame is not read,the caller should close the socket
+		return err
+	}
+	return fr.Close()
+}
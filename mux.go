@@ -0,0 +1,169 @@
+package netgo
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	gorilla "github.com/gorilla/websocket"
+)
+
+type MuxOption struct {
+	SniffTimeout      time.Duration         //timeout of waiting the first bytes,connection sends nothing is treated as raw tcp,also the timeout of reading http upgrade request header,default 5 seconds
+	ProxyProtocol     *ProxyProtocolOption  //read PROXY header before sniffing if not nil
+	NewPacketReceiver func() PacketReceiver //PacketReceiver of tcp and websocket Socket,nil means the default PacketReceiver
+	OnTcpSocket       func(Socket)          //raw tcp connection
+	Upgrader          *gorilla.Upgrader     //default &gorilla.Upgrader{}
+	WebSocketPath     string                //path of websocket upgrade,empty means all paths
+	OnWebSocket       func(Socket)          //websocket connection
+	TLSConfig         *tls.Config           //TLS connection is treated as raw tcp if nil
+	OnTLSConn         func(*tls.Conn)       //TLS connection,handshake is not done yet
+}
+
+// net.Listener accepts connections routed to http server
+type chanListener struct {
+	addr      net.Addr
+	conns     chan net.Conn
+	die       chan struct{}
+	closeOnce sync.Once
+}
+
+func (l *chanListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.die:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *chanListener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.die)
+	})
+	return nil
+}
+
+func (l *chanListener) Addr() net.Addr {
+	return l.addr
+}
+
+// read the first bytes of conn,data read is put back to conn.pending
+func sniff(conn *ProxyConn, timeout time.Duration) []byte {
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	defer conn.SetReadDeadline(time.Time{})
+	b := make([]byte, 4)
+	n := 0
+	for n < len(b) {
+		l, err := conn.Read(b[n:])
+		n += l
+		if err != nil || b[0] == 0x16 || string(b[:n]) != "GET "[:n] {
+			break
+		}
+	}
+	conn.pending = append(b[:n:n], conn.pending...)
+	return b[:n]
+}
+
+// listen on one port for raw tcp,websocket and TLS clients
+//
+// protocol of each connection is decided by the first bytes:TLS ClientHello(0x16),
+// http upgrade("GET "),otherwise raw tcp. Bytes read for sniffing are replayed.
+func ListenMux(nettype string, service string, option MuxOption) (net.Listener, func(), error) {
+	if option.SniffTimeout <= 0 {
+		option.SniffTimeout = time.Second * 5
+	}
+
+	if option.Upgrader == nil {
+		option.Upgrader = &gorilla.Upgrader{}
+	}
+
+	newPacketReceiver := func() PacketReceiver {
+		if option.NewPacketReceiver == nil {
+			return nil
+		}
+		return option.NewPacketReceiver()
+	}
+
+	var httpListener *chanListener
+
+	onNewclient := func(conn *net.TCPConn) {
+		go func() {
+			var pc *ProxyConn
+			if option.ProxyProtocol != nil {
+				var err error
+				if pc, err = ReadProxyHeader(conn, *option.ProxyProtocol); err != nil {
+					conn.Close()
+					return
+				}
+			} else {
+				pc = &ProxyConn{TCPConn: conn}
+			}
+
+			head := sniff(pc, option.SniffTimeout)
+			switch {
+			case len(head) > 0 && head[0] == 0x16 && option.TLSConfig != nil:
+				if option.OnTLSConn == nil {
+					pc.Close()
+				} else {
+					option.OnTLSConn(tls.Server(pc, option.TLSConfig))
+				}
+			case string(head) == "GET ":
+				select {
+				case httpListener.conns <- pc:
+				case <-httpListener.die:
+					pc.Close()
+				}
+			default:
+				if option.OnTcpSocket == nil {
+					pc.Close()
+				} else {
+					option.OnTcpSocket(NewProxyTcpSocket(pc, newPacketReceiver()))
+				}
+			}
+		}()
+	}
+
+	listener, serveTCP, err := ListenTCP(nettype, service, onNewclient)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	httpListener = &chanListener{
+		addr:  listener.Addr(),
+		conns: make(chan net.Conn),
+		die:   make(chan struct{}),
+	}
+
+	upgrade := func(w http.ResponseWriter, r *http.Request) {
+		conn, err := option.Upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		if option.OnWebSocket == nil {
+			conn.Close()
+		} else {
+			option.OnWebSocket(NewWebSocket(conn, newPacketReceiver()))
+		}
+	}
+
+	var handler http.Handler
+	if option.WebSocketPath == "" {
+		handler = http.HandlerFunc(upgrade)
+	} else {
+		mux := http.NewServeMux()
+		mux.HandleFunc(option.WebSocketPath, upgrade)
+		handler = mux
+	}
+
+	serve := func() {
+		//client stalls after "GET " mustn't hold the connection forever
+		go (&http.Server{Handler: handler, ReadHeaderTimeout: option.SniffTimeout}).Serve(httpListener)
+		serveTCP()
+		httpListener.Close()
+	}
+
+	return listener, serve, nil
+}
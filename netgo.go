@@ -1,73 +1,129 @@
-package netgo
-
-import (
-	"net"
-	"time"
-)
-
-func IsNetTimeoutError(err error) bool {
-	if e, ok := err.(net.Error); ok && e.Timeout() {
-		return true
-	} else {
-		return false
-	}
-}
-
-type ReadAble interface {
-	Read([]byte) (int, error)
-	SetReadDeadline(time.Time) error
-}
-
-type BuffersSender interface {
-	SendBuffers(net.Buffers, ...time.Time) (int64, error)
-}
-
-// recv a completely packet from ReadAble
-type PacketReceiver interface {
-	Recv(ReadAble, time.Time) ([]byte, error)
-}
-
-// interface for stream oriented socket
-type Socket interface {
-
-	//request send buff,if send block,wait unitl deadline
-	//
-	//if send ok return len(buff),nil. else return 0,reason
-	//
-	//if send is return with timeout,the first return value may more than zero but less then(len(buff))
-	Send([]byte, ...time.Time) (int, error)
-
-	//request receive a completely packet,if no packet avaliable,wait until deadline
-	Recv(...time.Time) ([]byte, error)
-
-	LocalAddr() net.Addr
-
-	RemoteAddr() net.Addr
-
-	SetUserData(ud interface{})
-
-	GetUserData() interface{}
-
-	GetUnderConn() interface{}
-
-	Close()
-}
-
-type userdata struct {
-	data interface{}
-}
-
-type defaultPacketReceiver struct {
-}
-
-// default PacketReceiver,all data from each read is returned as a packet
-func (dr *defaultPacketReceiver) Recv(r ReadAble, deadline time.Time) ([]byte, error) {
-	var (
-		n   int
-		err error
-	)
-	buff := make([]byte, 4096)
-	r.SetReadDeadline(deadline)
-	n, err = r.Read(buff)
-	return buff[:n], err
-}
+package netgo
+
+import (
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"github.com/sniperHW/netgo/poolbuff"
+)
+
+func IsNetTimeoutError(err error) bool {
+	if e, ok := err.(net.Error); ok && e.Timeout() {
+		return true
+	} else {
+		return false
+	}
+}
+
+type ReadAble interface {
+	Read([]byte) (int, error)
+	SetReadDeadline(time.Time) error
+}
+
+type BuffersSender interface {
+	SendBuffers(net.Buffers, ...time.Time) (int64, error)
+}
+
+// recv a completely packet from ReadAble
+type PacketReceiver interface {
+	Recv(ReadAble, time.Time) ([]byte, error)
+}
+
+var (
+	ErrStreamRecvNotSupported error = errors.New("streamRecvNotSupported")
+	ErrCloseWriteNotSupported error = errors.New("closeWriteNotSupported")
+)
+
+// optional interface of PacketReceiver,receive a packet as a stream
+//
+// handler is called with a reader bounded to the current packet,the reader is also an io.Closer,
+// Close discards the rest of the packet.
+//
+// data not read by handler is discarded after handler returned nil,
+// if handler returned an error,the rest is not read and the socket should be closed.
+type StreamPacketReceiver interface {
+	RecvStream(ReadAble, time.Time, func(io.Reader) error) error
+}
+
+// optional interface of Socket,receive a packet as a stream,see StreamPacketReceiver
+//
+// useful for large packet like file uploading,data is read directly from the underlying conn.
+type StreamReceiver interface {
+	RecvStream(func(io.Reader) error, ...time.Time) error
+}
+
+// optional interface of PacketReceiver and Socket
+//
+// packet returned by Recv is taken from poolbuff and owned by the caller,
+// it could be given back by ReleasePacket after use,packet never released is collected by GC.
+//
+// packet mustn't be touched after release
+type PacketReleaser interface {
+	ReleasePacket([]byte)
+}
+
+// optional interface of Socket,shut down the write side,the peer receives EOF after all sent data
+//
+// CanCloseWrite returns false if the underlying conn doesn't support half close
+type CloseWriter interface {
+	CloseWrite() error
+	CanCloseWrite() bool
+}
+
+// interface for stream oriented socket
+type Socket interface {
+
+	//request send buff,if send block,wait unitl deadline
+	//
+	//if send ok return len(buff),nil. else return 0,reason
+	//
+	//if send is return with timeout,the first return value may more than zero but less then(len(buff))
+	Send([]byte, ...time.Time) (int, error)
+
+	//request receive a completely packet,if no packet avaliable,wait until deadline
+	Recv(...time.Time) ([]byte, error)
+
+	LocalAddr() net.Addr
+
+	RemoteAddr() net.Addr
+
+	SetUserData(ud interface{})
+
+	GetUserData() interface{}
+
+	GetUnderConn() interface{}
+
+	Close()
+}
+
+type userdata struct {
+	data interface{}
+}
+
+type defaultPacketReceiver struct {
+}
+
+// default PacketReceiver,all data from each read is returned as a packet
+//
+// packet is taken from poolbuff
+func (dr *defaultPacketReceiver) Recv(r ReadAble, deadline time.Time) ([]byte, error) {
+	var (
+		n   int
+		err error
+	)
+	buff := poolbuff.Get()
+	if cap(buff) < 4096 {
+		buff = make([]byte, 4096)
+	} else {
+		buff = buff[:4096]
+	}
+	r.SetReadDeadline(deadline)
+	n, err = r.Read(buff)
+	return buff[:n], err
+}
+
+func (dr *defaultPacketReceiver) ReleasePacket(packet []byte) {
+	poolbuff.Put(packet[:cap(packet)])
+}
@@ -1,504 +1,2343 @@
-package netgo
-
-//go test -race -covermode=atomic -v -coverprofile=coverage.out -run=.
-//go tool cover -html=coverage.out
-import (
-	"context"
-	"crypto/sha1"
-	"errors"
-	"log"
-	"net"
-	"net/http"
-	"net/url"
-	"strings"
-	"sync"
-	"testing"
-	"time"
-
-	gorilla "github.com/gorilla/websocket"
-	"github.com/xtaci/kcp-go/v5"
-	"github.com/xtaci/smux"
-	"golang.org/x/crypto/pbkdf2"
-)
-
-func TestKcpSocket(t *testing.T) {
-	key := pbkdf2.Key([]byte("demo pass"), []byte("demo salt"), 1024, 32, sha1.New)
-	block, _ := kcp.NewAESBlockCrypt(key)
-
-	var (
-		listener *kcp.Listener
-		err      error
-	)
-
-	if listener, err = kcp.ListenWithOptions("localhost:8110", block, 10, 3); err == nil {
-		go func() {
-			for {
-				conn, err := listener.AcceptKCP()
-				if err != nil {
-					return
-				}
-
-				log.Println("TestKcpSocket:on new client")
-
-				s := NewKcpSocket(conn)
-				go func() {
-					for {
-						packet, err := s.Recv()
-						if nil != err {
-							log.Println("TestKcpSocket:server recv err:", err)
-							break
-						}
-						s.Send(packet)
-					}
-					s.Close()
-				}()
-			}
-		}()
-	} else {
-		log.Fatal(err)
-	}
-
-	{
-
-		key := pbkdf2.Key([]byte("demo pass"), []byte("demo salt"), 1024, 32, sha1.New)
-		block, _ := kcp.NewAESBlockCrypt(key)
-		// dial to the echo server
-		if conn, err := kcp.DialWithOptions("localhost:8110", block, 10, 3); err == nil {
-			s := NewKcpSocket(conn)
-
-			s.Send([]byte("hello"))
-
-			packet, err := s.Recv()
-
-			log.Println("TestKcpSocket:client", string(packet), err)
-
-			s.Close()
-		} else {
-			log.Fatal(err)
-		}
-	}
-
-	listener.Close()
-}
-
-func TestWebSocket(t *testing.T) {
-	{
-
-		tcpAddr, _ := net.ResolveTCPAddr("tcp", "localhost:18110")
-
-		listener, _ := net.ListenTCP("tcp", tcpAddr)
-
-		upgrader := &gorilla.Upgrader{
-			CheckOrigin: func(r *http.Request) bool {
-				return true
-			},
-		}
-
-		http.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
-			conn, _ := upgrader.Upgrade(w, r, nil)
-
-			conn.SetPingHandler(func(appData string) error {
-				log.Println("TestWebSocket:on ping")
-				conn.WriteMessage(gorilla.PongMessage, []byte(appData))
-				return nil
-			})
-
-			log.Println("TestWebSocket:on client")
-			s := NewWebSocket(conn)
-			go func() {
-				for {
-					packet, err := s.Recv()
-					if nil != err {
-						log.Println("TestWebSocket:server recv err:", err)
-						break
-					}
-					s.Send(packet)
-				}
-				s.Close()
-			}()
-		})
-
-		go func() {
-			http.Serve(listener, nil)
-		}()
-
-		{
-
-			u := url.URL{Scheme: "ws", Host: "localhost:18110", Path: "/echo"}
-			dialer := gorilla.DefaultDialer
-
-			conn, _, _ := dialer.Dial(u.String(), nil)
-
-			respChan := make(chan struct{})
-			s := NewWebSocket(conn)
-
-			conn.WriteMessage(gorilla.PingMessage, []byte("hello"))
-
-			conn.SetPongHandler(func(appData string) error {
-				log.Println("TestWebSocket:on pong")
-				close(respChan)
-				return nil
-			})
-
-			go func() {
-				//触发recv接收Pong
-				s.Recv()
-			}()
-
-			<-respChan
-
-			s.Close()
-		}
-
-		{
-			u := url.URL{Scheme: "ws", Host: "localhost:18110", Path: "/echo"}
-			dialer := gorilla.DefaultDialer
-
-			conn, _, _ := dialer.Dial(u.String(), nil)
-
-			s := NewWebSocket(conn)
-
-			s.Send([]byte("hello"))
-
-			packet, err := s.Recv()
-
-			log.Println("TestWebSocket:client", string(packet), err)
-
-			s.Close()
-		}
-
-		listener.Close()
-
-	}
-}
-
-func TestAsynSocket(t *testing.T) {
-	MaxSendBlockSize = 64
-	{
-		listener, serve, _ := ListenTCP("tcp", "localhost:18110", func(conn *net.TCPConn) {
-			log.Println("TestAsynSocket: on client")
-			NewAsynSocket(NewTcpSocket(conn), AsynSocketOption{
-				AutoRecv:        true,
-				AutoRecvTimeout: time.Second,
-			}).SetCloseCallback(func(_ *AsynSocket, err error) {
-				log.Println("TestAsynSocket: server closed err:", err)
-			}).SetPacketHandler(func(_ context.Context, as *AsynSocket, packet interface{}) error {
-				log.Println("TestAsynSocket: server on packet", string(packet.([]byte)))
-				if err := as.Send(packet); nil != err {
-					return err
-				} else {
-					return nil
-				}
-			}).Recv(time.Now().Add(time.Second))
-		})
-
-		go serve()
-
-		log.Println("here")
-
-		dialer := &net.Dialer{}
-
-		{
-			conn, _ := dialer.Dial("tcp", "localhost:18110")
-			okChan := make(chan struct{})
-
-			as := NewAsynSocket(NewTcpSocket(conn.(*net.TCPConn)), AsynSocketOption{}).SetCloseCallback(func(_ *AsynSocket, err error) {
-				log.Println("TestAsynSocket: client closed err:", err)
-			}).SetPacketHandler(func(_ context.Context, as *AsynSocket, packet interface{}) error {
-				log.Println("TestAsynSocket: client", string(packet.([]byte)))
-				close(okChan)
-				return nil
-			}).Recv()
-			log.Println("TestAsynSocket: send", as.Send([]byte("hello")))
-			<-okChan
-			as.Close(nil)
-		}
-
-		log.Println("TestAsynSocket:-----------------------------")
-
-		{
-			conn, _ := dialer.Dial("tcp", "localhost:18110")
-			okChan := make(chan struct{})
-			as := NewAsynSocket(NewTcpSocket(conn.(*net.TCPConn)), AsynSocketOption{}).SetCloseCallback(func(_ *AsynSocket, err error) {
-				log.Println("TestAsynSocket:client closed err:", err)
-				close(okChan)
-			}).Recv()
-			<-okChan
-			as.Close(nil)
-		}
-
-		listener.Close()
-	}
-
-	{
-
-		log.Println("TestAsynSocket:-----------------------------2------")
-
-		okChan := make(chan struct{})
-
-		listener, serve, _ := ListenTCP("tcp", "localhost:18110", func(conn *net.TCPConn) {
-			log.Println("TestAsynSocket:on client")
-			i := 0
-			NewAsynSocket(NewTcpSocket(conn), AsynSocketOption{}).SetCloseCallback(func(_ *AsynSocket, err error) {
-				log.Println("TestAsynSocket:server closed err:", err)
-			}).SetPacketHandler(func(_ context.Context, as *AsynSocket, packet interface{}) error {
-				i = i + len(packet.([]byte))
-				log.Println("TestAsynSocket:", i)
-				if i == 100*5 {
-					close(okChan)
-				} else {
-					as.Recv(time.Now().Add(time.Second))
-				}
-				return nil
-			}).Recv(time.Now().Add(time.Second))
-		})
-
-		go serve()
-
-		dialer := &net.Dialer{}
-
-		{
-			conn, _ := dialer.Dial("tcp", "localhost:18110")
-			as := NewAsynSocket(NewTcpSocket(conn.(*net.TCPConn)), AsynSocketOption{
-				SendChanSize: 1000,
-			}).SetCloseCallback(func(_ *AsynSocket, err error) {
-				log.Println("TestAsynSocket:client closed err:", err)
-			})
-
-			for i := 0; i < 100; i++ {
-				as.Send([]byte("hello"), time.Now().Add(time.Second))
-			}
-
-			as.Close(nil)
-
-			<-okChan
-		}
-
-		listener.Close()
-
-	}
-	// test cancel
-	{
-		c := make(chan struct{})
-
-		listener, serve, _ := ListenTCP("tcp", "localhost:18110", func(conn *net.TCPConn) {
-			log.Println("TestAsynSocket: on client")
-			ctx, cancel := context.WithCancel(context.Background())
-			NewAsynSocket(NewTcpSocket(conn), AsynSocketOption{
-				AutoRecv:        true,
-				AutoRecvTimeout: time.Second,
-				Context:         ctx,
-			}).SetCloseCallback(func(_ *AsynSocket, err error) {
-				cancel()
-				log.Println("TestAsynSocket: server closed err:", err)
-			}).SetPacketHandler(func(ctx context.Context, as *AsynSocket, packet interface{}) error {
-				go func() {
-					<-ctx.Done()
-					log.Println("context Done error:", ctx.Err())
-					close(c)
-				}()
-				return nil
-			}).Recv(time.Now().Add(time.Second))
-		})
-
-		go serve()
-
-		log.Println("here")
-
-		dialer := &net.Dialer{}
-
-		conn, _ := dialer.Dial("tcp", "localhost:18110")
-
-		as := NewAsynSocket(NewTcpSocket(conn.(*net.TCPConn)), AsynSocketOption{})
-		as.Send([]byte("hello"), time.Now().Add(time.Second))
-		as.Close(nil)
-		<-c
-		listener.Close()
-	}
-}
-
-func TestTCPSocket(t *testing.T) {
-
-	{
-		listener, serve, _ := ListenTCP("tcp", "localhost:18110", func(conn *net.TCPConn) {
-			log.Println("TestTCPSocket:on client")
-			s := NewTcpSocket(conn)
-			go func() {
-				for {
-					packet, err := s.Recv(time.Now().Add(time.Second))
-					if nil != err {
-						log.Println("TestTCPSocket:server recv err:", err)
-						break
-					}
-					s.Send(packet)
-				}
-				s.Close()
-			}()
-		})
-
-		go serve()
-
-		dialer := &net.Dialer{}
-
-		{
-			conn, _ := dialer.Dial("tcp", "localhost:18110")
-			s := NewTcpSocket(conn.(*net.TCPConn))
-			s.Send([]byte("hello"))
-			packet, err := s.Recv()
-			log.Println("TestTCPSocket:client", string(packet), err)
-			s.Close()
-		}
-
-		{
-			conn, _ := dialer.Dial("tcp", "localhost:18110")
-			s := NewTcpSocket(conn.(*net.TCPConn))
-			packet, err := s.Recv()
-			log.Println("TestTCPSocket:client", string(packet), err)
-			s.Close()
-
-		}
-
-		listener.Close()
-	}
-}
-
-func TestAsynSocket2(t *testing.T) {
-
-	listener, serve, _ := ListenTCP("tcp", "localhost:18110", func(conn *net.TCPConn) {
-		log.Println("TestAsynSocket:on client")
-		NewAsynSocket(NewTcpSocket(conn), AsynSocketOption{}).SetCloseCallback(func(_ *AsynSocket, err error) {
-			log.Println("TestAsynSocket:server closed err:", err)
-		}).SetPacketHandler(func(_ context.Context, as *AsynSocket, packet interface{}) error {
-			as.Send(packet)
-			as.Recv(time.Now().Add(time.Second))
-			return nil
-		}).Recv(time.Now().Add(time.Second))
-	})
-
-	go serve()
-
-	dialer := &net.Dialer{}
-
-	{
-
-		okChan := make(chan struct{})
-		total := 0
-		msg := []byte(strings.Repeat("a", 1024))
-		conn, _ := dialer.Dial("tcp", "localhost:18110")
-		as := NewAsynSocket(NewTcpSocket(conn.(*net.TCPConn)), AsynSocketOption{
-			SendChanSize: 1000,
-		}).SetCloseCallback(func(_ *AsynSocket, err error) {
-			log.Println("TestAsynSocket:client closed err:", err)
-		}).SetPacketHandler(func(_ context.Context, as *AsynSocket, packet interface{}) error {
-			total += len(packet.([]byte))
-			//log.Println(total)
-			if total >= 1024*10000 {
-				close(okChan)
-				return errors.New("active close")
-			}
-			as.Send(packet)
-			as.Recv(time.Now().Add(time.Second))
-			return nil
-		}).Recv(time.Now().Add(time.Second))
-
-		beg := time.Now()
-
-		for i := 0; i < 100; i++ {
-			as.Send(msg)
-		}
-
-		<-okChan
-
-		log.Println("use", time.Since(beg))
-
-		as.Close(nil)
-	}
-
-	listener.Close()
-
-}
-
-func TestStream(t *testing.T) {
-
-	listenStream := func(session *smux.Session, onNewStream func(*smux.Stream)) (func() error, error) {
-		return func() error {
-			for {
-				if s, err := session.AcceptStream(); err == nil {
-					onNewStream(s)
-				} else {
-					return err
-				}
-			}
-		}, nil
-	}
-
-	var sessions sync.Map
-
-	listener, serve, _ := ListenTCP("tcp", "localhost:18110", func(conn *net.TCPConn) {
-		if server, err := smux.Server(conn, nil); err == nil {
-			sessions.Store(server, struct{}{})
-			serve, _ := listenStream(server, func(s *smux.Stream) {
-				ss := NewStream(s)
-				go func() {
-					for {
-						packet, err := ss.Recv(time.Now().Add(time.Second))
-						if nil != err {
-							log.Println("TestStream:server recv err:", err)
-							break
-						}
-						log.Println("recv from stream", s.ID())
-						ss.Send(packet)
-					}
-					s.Close()
-				}()
-			})
-			go func() {
-				serve()
-				sessions.Delete(server)
-			}()
-		} else {
-			panic(err)
-		}
-	})
-
-	go serve()
-
-	dialer := &net.Dialer{}
-	conn, _ := dialer.Dial("tcp", "localhost:18110")
-	if streamCli, err := smux.Client(conn, nil); err != nil {
-		panic(err)
-	} else {
-		{
-			s, err := streamCli.OpenStream()
-			if err != nil {
-				panic(err)
-			}
-			ss := NewStream(s)
-			ss.Send([]byte("hello"))
-			packet, err := ss.Recv()
-			log.Println("TestTCPSocket:client", string(packet), err)
-			ss.Close()
-		}
-
-		{
-			s, err := streamCli.OpenStream()
-			if err != nil {
-				panic(err)
-			}
-			ss := NewStream(s)
-			ss.Send([]byte("hello"))
-			packet, err := ss.Recv()
-			log.Println("TestTCPSocket:client", string(packet), err)
-			ss.Close()
-		}
-
-	}
-
-	sessions.Range(func(key, value interface{}) bool {
-		key.(*smux.Session).Close()
-		return true
-	})
-
-	listener.Close()
-
-}
+package netgo
+
+//go test -race -covermode=atomic -v -coverprofile=coverage.out -run=.
+//go tool cover -html=coverage.out
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	gorilla "github.com/gorilla/websocket"
+	"github.com/xtaci/kcp-go/v5"
+	"github.com/xtaci/smux"
+	"golang.org/x/crypto/pbkdf2"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestKcpSocket(t *testing.T) {
+	key := pbkdf2.Key([]byte("demo pass"), []byte("demo salt"), 1024, 32, sha1.New)
+	block, _ := kcp.NewAESBlockCrypt(key)
+
+	var (
+		listener *kcp.Listener
+		err      error
+	)
+
+	if listener, err = kcp.ListenWithOptions("localhost:8110", block, 10, 3); err == nil {
+		go func() {
+			for {
+				conn, err := listener.AcceptKCP()
+				if err != nil {
+					return
+				}
+
+				log.Println("TestKcpSocket:on new client")
+
+				s := NewKcpSocket(conn)
+				go func() {
+					for {
+						packet, err := s.Recv()
+						if nil != err {
+							log.Println("TestKcpSocket:server recv err:", err)
+							break
+						}
+						s.Send(packet)
+					}
+					s.Close()
+				}()
+			}
+		}()
+	} else {
+		log.Fatal(err)
+	}
+
+	{
+
+		key := pbkdf2.Key([]byte("demo pass"), []byte("demo salt"), 1024, 32, sha1.New)
+		block, _ := kcp.NewAESBlockCrypt(key)
+		// dial to the echo server
+		if conn, err := kcp.DialWithOptions("localhost:8110", block, 10, 3); err == nil {
+			s := NewKcpSocket(conn)
+
+			s.Send([]byte("hello"))
+
+			packet, err := s.Recv()
+
+			log.Println("TestKcpSocket:client", string(packet), err)
+
+			s.Close()
+		} else {
+			log.Fatal(err)
+		}
+	}
+
+	listener.Close()
+}
+
+func TestWebSocket(t *testing.T) {
+	{
+
+		tcpAddr, _ := net.ResolveTCPAddr("tcp", "localhost:18110")
+
+		listener, _ := net.ListenTCP("tcp", tcpAddr)
+
+		upgrader := &gorilla.Upgrader{
+			CheckOrigin: func(r *http.Request) bool {
+				return true
+			},
+		}
+
+		http.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+			conn, _ := upgrader.Upgrade(w, r, nil)
+
+			conn.SetPingHandler(func(appData string) error {
+				log.Println("TestWebSocket:on ping")
+				conn.WriteMessage(gorilla.PongMessage, []byte(appData))
+				return nil
+			})
+
+			log.Println("TestWebSocket:on client")
+			s := NewWebSocket(conn)
+			go func() {
+				for {
+					packet, err := s.Recv()
+					if nil != err {
+						log.Println("TestWebSocket:server recv err:", err)
+						break
+					}
+					s.Send(packet)
+				}
+				s.Close()
+			}()
+		})
+
+		go func() {
+			http.Serve(listener, nil)
+		}()
+
+		{
+
+			u := url.URL{Scheme: "ws", Host: "localhost:18110", Path: "/echo"}
+			dialer := gorilla.DefaultDialer
+
+			conn, _, _ := dialer.Dial(u.String(), nil)
+
+			respChan := make(chan struct{})
+			s := NewWebSocket(conn)
+
+			conn.WriteMessage(gorilla.PingMessage, []byte("hello"))
+
+			conn.SetPongHandler(func(appData string) error {
+				log.Println("TestWebSocket:on pong")
+				close(respChan)
+				return nil
+			})
+
+			go func() {
+				//触发recv接收Pong
+				s.Recv()
+			}()
+
+			<-respChan
+
+			s.Close()
+		}
+
+		{
+			u := url.URL{Scheme: "ws", Host: "localhost:18110", Path: "/echo"}
+			dialer := gorilla.DefaultDialer
+
+			conn, _, _ := dialer.Dial(u.String(), nil)
+
+			s := NewWebSocket(conn)
+
+			s.Send([]byte("hello"))
+
+			packet, err := s.Recv()
+
+			log.Println("TestWebSocket:client", string(packet), err)
+
+			s.Close()
+		}
+
+		listener.Close()
+
+	}
+}
+
+func TestAsynSocket(t *testing.T) {
+	MaxSendBlockSize = 64
+	{
+		listener, serve, _ := ListenTCP("tcp", "localhost:18110", func(conn *net.TCPConn) {
+			log.Println("TestAsynSocket: on client")
+			NewAsynSocket(NewTcpSocket(conn), AsynSocketOption{
+				AutoRecv:        true,
+				AutoRecvTimeout: time.Second,
+			}).SetCloseCallback(func(_ *AsynSocket, err error) {
+				log.Println("TestAsynSocket: server closed err:", err)
+			}).SetPacketHandler(func(_ context.Context, as *AsynSocket, packet interface{}) error {
+				log.Println("TestAsynSocket: server on packet", string(packet.([]byte)))
+				if err := as.Send(packet); nil != err {
+					return err
+				} else {
+					return nil
+				}
+			}).Recv(time.Now().Add(time.Second))
+		})
+
+		go serve()
+
+		log.Println("here")
+
+		dialer := &net.Dialer{}
+
+		{
+			conn, _ := dialer.Dial("tcp", "localhost:18110")
+			okChan := make(chan struct{})
+
+			as := NewAsynSocket(NewTcpSocket(conn.(*net.TCPConn)), AsynSocketOption{}).SetCloseCallback(func(_ *AsynSocket, err error) {
+				log.Println("TestAsynSocket: client closed err:", err)
+			}).SetPacketHandler(func(_ context.Context, as *AsynSocket, packet interface{}) error {
+				log.Println("TestAsynSocket: client", string(packet.([]byte)))
+				close(okChan)
+				return nil
+			}).Recv()
+			log.Println("TestAsynSocket: send", as.Send([]byte("hello")))
+			<-okChan
+			as.Close(nil)
+		}
+
+		log.Println("TestAsynSocket:-----------------------------")
+
+		{
+			conn, _ := dialer.Dial("tcp", "localhost:18110")
+			okChan := make(chan struct{})
+			as := NewAsynSocket(NewTcpSocket(conn.(*net.TCPConn)), AsynSocketOption{}).SetCloseCallback(func(_ *AsynSocket, err error) {
+				log.Println("TestAsynSocket:client closed err:", err)
+				close(okChan)
+			}).Recv()
+			<-okChan
+			as.Close(nil)
+		}
+
+		listener.Close()
+	}
+
+	{
+
+		log.Println("TestAsynSocket:-----------------------------2------")
+
+		okChan := make(chan struct{})
+
+		listener, serve, _ := ListenTCP("tcp", "localhost:18110", func(conn *net.TCPConn) {
+			log.Println("TestAsynSocket:on client")
+			i := 0
+			NewAsynSocket(NewTcpSocket(conn), AsynSocketOption{}).SetCloseCallback(func(_ *AsynSocket, err error) {
+				log.Println("TestAsynSocket:server closed err:", err)
+			}).SetPacketHandler(func(_ context.Context, as *AsynSocket, packet interface{}) error {
+				i = i + len(packet.([]byte))
+				log.Println("TestAsynSocket:", i)
+				if i == 100*5 {
+					close(okChan)
+				} else {
+					as.Recv(time.Now().Add(time.Second))
+				}
+				return nil
+			}).Recv(time.Now().Add(time.Second))
+		})
+
+		go serve()
+
+		dialer := &net.Dialer{}
+
+		{
+			conn, _ := dialer.Dial("tcp", "localhost:18110")
+			as := NewAsynSocket(NewTcpSocket(conn.(*net.TCPConn)), AsynSocketOption{
+				SendChanSize: 1000,
+			}).SetCloseCallback(func(_ *AsynSocket, err error) {
+				log.Println("TestAsynSocket:client closed err:", err)
+			})
+
+			for i := 0; i < 100; i++ {
+				as.Send([]byte("hello"), time.Now().Add(time.Second))
+			}
+
+			as.Close(nil)
+
+			<-okChan
+		}
+
+		listener.Close()
+
+	}
+	// test cancel
+	{
+		c := make(chan struct{})
+
+		listener, serve, _ := ListenTCP("tcp", "localhost:18110", func(conn *net.TCPConn) {
+			log.Println("TestAsynSocket: on client")
+			ctx, cancel := context.WithCancel(context.Background())
+			NewAsynSocket(NewTcpSocket(conn), AsynSocketOption{
+				AutoRecv:        true,
+				AutoRecvTimeout: time.Second,
+				Context:         ctx,
+			}).SetCloseCallback(func(_ *AsynSocket, err error) {
+				cancel()
+				log.Println("TestAsynSocket: server closed err:", err)
+			}).SetPacketHandler(func(ctx context.Context, as *AsynSocket, packet interface{}) error {
+				go func() {
+					<-ctx.Done()
+					log.Println("context Done error:", ctx.Err())
+					close(c)
+				}()
+				return nil
+			}).Recv(time.Now().Add(time.Second))
+		})
+
+		go serve()
+
+		log.Println("here")
+
+		dialer := &net.Dialer{}
+
+		conn, _ := dialer.Dial("tcp", "localhost:18110")
+
+		as := NewAsynSocket(NewTcpSocket(conn.(*net.TCPConn)), AsynSocketOption{})
+		as.Send([]byte("hello"), time.Now().Add(time.Second))
+		as.Close(nil)
+		<-c
+		listener.Close()
+	}
+}
+
+func TestTCPSocket(t *testing.T) {
+
+	{
+		listener, serve, _ := ListenTCP("tcp", "localhost:18110", func(conn *net.TCPConn) {
+			log.Println("TestTCPSocket:on client")
+			s := NewTcpSocket(conn)
+			go func() {
+				for {
+					packet, err := s.Recv(time.Now().Add(time.Second))
+					if nil != err {
+						log.Println("TestTCPSocket:server recv err:", err)
+						break
+					}
+					s.Send(packet)
+				}
+				s.Close()
+			}()
+		})
+
+		go serve()
+
+		dialer := &net.Dialer{}
+
+		{
+			conn, _ := dialer.Dial("tcp", "localhost:18110")
+			s := NewTcpSocket(conn.(*net.TCPConn))
+			s.Send([]byte("hello"))
+			packet, err := s.Recv()
+			log.Println("TestTCPSocket:client", string(packet), err)
+			s.Close()
+		}
+
+		{
+			conn, _ := dialer.Dial("tcp", "localhost:18110")
+			s := NewTcpSocket(conn.(*net.TCPConn))
+			packet, err := s.Recv()
+			log.Println("TestTCPSocket:client", string(packet), err)
+			s.Close()
+
+		}
+
+		listener.Close()
+	}
+}
+
+func TestAsynSocket2(t *testing.T) {
+
+	listener, serve, _ := ListenTCP("tcp", "localhost:18110", func(conn *net.TCPConn) {
+		log.Println("TestAsynSocket:on client")
+		NewAsynSocket(NewTcpSocket(conn), AsynSocketOption{}).SetCloseCallback(func(_ *AsynSocket, err error) {
+			log.Println("TestAsynSocket:server closed err:", err)
+		}).SetPacketHandler(func(_ context.Context, as *AsynSocket, packet interface{}) error {
+			as.Send(packet)
+			as.Recv(time.Now().Add(time.Second))
+			return nil
+		}).Recv(time.Now().Add(time.Second))
+	})
+
+	go serve()
+
+	dialer := &net.Dialer{}
+
+	{
+
+		okChan := make(chan struct{})
+		total := 0
+		msg := []byte(strings.Repeat("a", 1024))
+		conn, _ := dialer.Dial("tcp", "localhost:18110")
+		as := NewAsynSocket(NewTcpSocket(conn.(*net.TCPConn)), AsynSocketOption{
+			SendChanSize: 1000,
+		}).SetCloseCallback(func(_ *AsynSocket, err error) {
+			log.Println("TestAsynSocket:client closed err:", err)
+		}).SetPacketHandler(func(_ context.Context, as *AsynSocket, packet interface{}) error {
+			total += len(packet.([]byte))
+			//log.Println(total)
+			if total >= 1024*10000 {
+				close(okChan)
+				return errors.New("active close")
+			}
+			as.Send(packet)
+			as.Recv(time.Now().Add(time.Second))
+			return nil
+		}).Recv(time.Now().Add(time.Second))
+
+		beg := time.Now()
+
+		for i := 0; i < 100; i++ {
+			as.Send(msg)
+		}
+
+		<-okChan
+
+		log.Println("use", time.Since(beg))
+
+		as.Close(nil)
+	}
+
+	listener.Close()
+
+}
+
+func TestStream(t *testing.T) {
+
+	listenStream := func(session *smux.Session, onNewStream func(*smux.Stream)) (func() error, error) {
+		return func() error {
+			for {
+				if s, err := session.AcceptStream(); err == nil {
+					onNewStream(s)
+				} else {
+					return err
+				}
+			}
+		}, nil
+	}
+
+	var sessions sync.Map
+
+	listener, serve, _ := ListenTCP("tcp", "localhost:18110", func(conn *net.TCPConn) {
+		if server, err := smux.Server(conn, nil); err == nil {
+			sessions.Store(server, struct{}{})
+			serve, _ := listenStream(server, func(s *smux.Stream) {
+				ss := NewStream(s)
+				go func() {
+					for {
+						packet, err := ss.Recv(time.Now().Add(time.Second))
+						if nil != err {
+							log.Println("TestStream:server recv err:", err)
+							break
+						}
+						log.Println("recv from stream", s.ID())
+						ss.Send(packet)
+					}
+					s.Close()
+				}()
+			})
+			go func() {
+				serve()
+				sessions.Delete(server)
+			}()
+		} else {
+			panic(err)
+		}
+	})
+
+	go serve()
+
+	dialer := &net.Dialer{}
+	conn, _ := dialer.Dial("tcp", "localhost:18110")
+	if streamCli, err := smux.Client(conn, nil); err != nil {
+		panic(err)
+	} else {
+		{
+			s, err := streamCli.OpenStream()
+			if err != nil {
+				panic(err)
+			}
+			ss := NewStream(s)
+			ss.Send([]byte("hello"))
+			packet, err := ss.Recv()
+			log.Println("TestTCPSocket:client", string(packet), err)
+			ss.Close()
+		}
+
+		{
+			s, err := streamCli.OpenStream()
+			if err != nil {
+				panic(err)
+			}
+			ss := NewStream(s)
+			ss.Send([]byte("hello"))
+			packet, err := ss.Recv()
+			log.Println("TestTCPSocket:client", string(packet), err)
+			ss.Close()
+		}
+
+	}
+
+	sessions.Range(func(key, value interface{}) bool {
+		key.(*smux.Session).Close()
+		return true
+	})
+
+	listener.Close()
+
+}
+
+// ReadAble returns data in chunks of the given sizes
+type chunkReader struct {
+	data   []byte
+	chunks []int
+}
+
+func (cr *chunkReader) Read(b []byte) (int, error) {
+	if len(cr.data) == 0 {
+		return 0, io.EOF
+	}
+	n := len(cr.data)
+	if len(cr.chunks) > 0 {
+		if cr.chunks[0] < n {
+			n = cr.chunks[0]
+		}
+		cr.chunks = cr.chunks[1:]
+	}
+	if n > len(b) {
+		n = len(b)
+	}
+	n = copy(b[:n], cr.data)
+	cr.data = cr.data[n:]
+	return n, nil
+}
+
+func (cr *chunkReader) SetReadDeadline(time.Time) error {
+	return nil
+}
+
+func TestLengthPrefixReceiver(t *testing.T) {
+	for _, headerSize := range []int{1, 2, 4, 8} {
+		for _, included := range []bool{false, true} {
+			r := NewLengthPrefixReceiver(LengthPrefixOption{
+				HeaderSize:     headerSize,
+				ByteOrder:      binary.LittleEndian,
+				MaxPacketSize:  200,
+				HeaderIncluded: included,
+			})
+			var buffs net.Buffers
+			for _, msg := range []string{"hello", "", strings.Repeat("b", 200)} {
+				buffs, _ = r.AppendHeader(buffs, len(msg))
+				buffs = append(buffs, []byte(msg))
+			}
+			var data []byte
+			for _, v := range buffs {
+				data = append(data, v...)
+			}
+
+			cr := &chunkReader{data: data, chunks: []int{1, 3, 2, 100, 7}}
+			for _, msg := range []string{"hello", "", strings.Repeat("b", 200)} {
+				packet, err := r.Recv(cr, time.Time{})
+				if err != nil || string(packet) != msg {
+					t.Fatal(headerSize, included, err, string(packet))
+				}
+			}
+			if _, err := r.Recv(cr, time.Time{}); err != io.EOF {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	r := NewLengthPrefixReceiver(LengthPrefixOption{MaxPacketSize: 10})
+	if buffs, n := r.AppendHeader(nil, 11); n != 0 || len(buffs) != 0 {
+		t.Fatal("header appended for packet exceeds MaxPacketSize")
+	}
+	//header can't hold the length
+	if _, n := NewLengthPrefixReceiver(LengthPrefixOption{HeaderSize: 1, MaxPacketSize: 1000}).AppendHeader(nil, 256); n != 0 {
+		t.Fatal("length truncated")
+	}
+	if _, n := NewLengthPrefixReceiver(LengthPrefixOption{HeaderSize: 1, HeaderIncluded: true, MaxPacketSize: 1000}).AppendHeader(nil, 255); n != 0 {
+		t.Fatal("length truncated")
+	}
+
+	buffs, _ := NewLengthPrefixReceiver(LengthPrefixOption{}).AppendHeader(nil, 11)
+	_, err := r.Recv(&chunkReader{data: buffs[0]}, time.Time{})
+	var tooLarge *PacketTooLargeError
+	if !errors.As(err, &tooLarge) || tooLarge.Size != 11 {
+		t.Fatal(err)
+	}
+}
+
+func TestVarintLengthReceiver(t *testing.T) {
+	msgs := []string{"hello", strings.Repeat("a", 300), ""}
+	var buffs net.Buffers
+	for _, msg := range msgs {
+		buffs, _ = AppendUvarintHeader(buffs, len(msg))
+		buffs = append(buffs, []byte(msg))
+	}
+	var data []byte
+	for _, v := range buffs {
+		data = append(data, v...)
+	}
+
+	{
+		//varint of the 300 bytes packet is split across reads
+		r := NewVarintLengthReceiver(0)
+		cr := &chunkReader{data: data, chunks: []int{7, 1, 1, 50}}
+		for _, msg := range msgs {
+			packet, err := r.Recv(cr, time.Time{})
+			if err != nil || string(packet) != msg {
+				t.Fatal(err, string(packet))
+			}
+		}
+	}
+
+	{
+		r := NewVarintLengthReceiver(0)
+		_, err := r.Recv(&chunkReader{data: []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}}, time.Time{})
+		if err != ErrVarintOverflow {
+			t.Fatal(err)
+		}
+	}
+
+	{
+		//packets over websocket,each message carries part of the stream
+		tcpAddr, _ := net.ResolveTCPAddr("tcp", "localhost:18111")
+		listener, _ := net.ListenTCP("tcp", tcpAddr)
+		upgrader := &gorilla.Upgrader{}
+		recvChan := make(chan string, len(msgs))
+		mux := http.NewServeMux()
+		mux.HandleFunc("/varint", func(w http.ResponseWriter, r *http.Request) {
+			conn, _ := upgrader.Upgrade(w, r, nil)
+			s := NewWebSocket(conn, NewVarintLengthReceiver(0))
+			for {
+				packet, err := s.Recv()
+				if nil != err {
+					break
+				}
+				recvChan <- string(packet)
+			}
+			s.Close()
+		})
+		go http.Serve(listener, mux)
+
+		conn, _, err := gorilla.DefaultDialer.Dial("ws://localhost:18111/varint", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.WriteMessage(gorilla.BinaryMessage, data[:1])
+		conn.WriteMessage(gorilla.BinaryMessage, data[1:10])
+		conn.WriteMessage(gorilla.BinaryMessage, data[10:])
+		for _, msg := range msgs {
+			if packet := <-recvChan; packet != msg {
+				t.Fatal(packet)
+			}
+		}
+		conn.Close()
+		listener.Close()
+	}
+}
+
+func TestDelimiterReceiver(t *testing.T) {
+	{
+		r := NewDelimiterReceiver(DelimiterOption{
+			Delimiter:      []byte("\r\n"),
+			StripDelimiter: true,
+		})
+		//"\r\n" split across reads
+		cr := &chunkReader{data: []byte("hello\r\n\r\nworld\r\n"), chunks: []int{6, 1, 1, 1, 3}}
+		for _, line := range []string{"hello", "", "world"} {
+			packet, err := r.Recv(cr, time.Time{})
+			if err != nil || string(packet) != line {
+				t.Fatal(err, string(packet))
+			}
+		}
+		if _, err := r.Recv(cr, time.Time{}); err != io.EOF {
+			t.Fatal(err)
+		}
+	}
+
+	{
+		r := NewDelimiterReceiver(DelimiterOption{
+			Delimiter: []byte{0},
+		})
+		packet, err := r.Recv(&chunkReader{data: []byte("a\x00b")}, time.Time{})
+		if err != nil || string(packet) != "a\x00" {
+			t.Fatal(err, packet)
+		}
+	}
+
+	{
+		r := NewDelimiterReceiver(DelimiterOption{
+			MaxLength: 4,
+		})
+		_, err := r.Recv(&chunkReader{data: []byte("hello\n"), chunks: []int{1, 1, 1, 1, 1, 1}}, time.Time{})
+		var tooLarge *PacketTooLargeError
+		if !errors.As(err, &tooLarge) {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLengthFieldReceiver(t *testing.T) {
+	makeFrame := func(body string, lengthIncludeHeader bool) []byte {
+		frame := []byte{0xCA, 0xFE, 1, 0, 0, 0, 0}
+		l := len(body)
+		if lengthIncludeHeader {
+			l += len(frame)
+		}
+		binary.BigEndian.PutUint32(frame[3:], uint32(l))
+		return append(frame, body...)
+	}
+
+	{
+		r := NewLengthFieldReceiver(LengthFieldOption{
+			LengthFieldOffset: 3,
+		})
+		data := append(makeFrame("hello", false), makeFrame("world", false)...)
+		cr := &chunkReader{data: data, chunks: []int{2, 3, 4, 1}}
+		for _, body := range []string{"hello", "world"} {
+			packet, err := r.Recv(cr, time.Time{})
+			if err != nil || string(packet[7:]) != body || packet[0] != 0xCA {
+				t.Fatal(err, packet)
+			}
+		}
+	}
+
+	{
+		//length counts the header,strip the header
+		r := NewLengthFieldReceiver(LengthFieldOption{
+			LengthFieldOffset:   3,
+			LengthAdjustment:    -7,
+			InitialBytesToStrip: 7,
+		})
+		packet, err := r.Recv(&chunkReader{data: makeFrame("hello", true)}, time.Time{})
+		if err != nil || string(packet) != "hello" {
+			t.Fatal(err, packet)
+		}
+	}
+
+	{
+		r := NewLengthFieldReceiver(LengthFieldOption{
+			LengthFieldOffset: 3,
+			MaxFrameLength:    10,
+		})
+		_, err := r.Recv(&chunkReader{data: makeFrame("hello", false)}, time.Time{})
+		var tooLarge *PacketTooLargeError
+		if !errors.As(err, &tooLarge) {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestZeroCopy(t *testing.T) {
+	recvChan := make(chan string, 1)
+	listener, serve, _ := ListenTCP("tcp", "localhost:18110", func(conn *net.TCPConn) {
+		NewAsynSocket(NewTcpSocket(conn), AsynSocketOption{
+			ZeroCopy: true,
+		}).SetPacketHandler(func(_ context.Context, as *AsynSocket, packet interface{}) error {
+			b := packet.([]byte)
+			if cap(b) < 4096 {
+				return errors.New("packet should be taken from poolbuff")
+			}
+			recvChan <- string(b)
+			as.ReleasePacket(b)
+			return nil
+		}).Recv()
+	})
+
+	go serve()
+
+	dialer := &net.Dialer{}
+	conn, _ := dialer.Dial("tcp", "localhost:18110")
+	s := NewTcpSocket(conn.(*net.TCPConn))
+	s.Send([]byte("hello"))
+	if packet := <-recvChan; packet != "hello" {
+		t.Fatal(packet)
+	}
+	s.Close()
+	listener.Close()
+}
+
+func TestChecksumReceiver(t *testing.T) {
+	recvChan := make(chan string, 1)
+	closeChan := make(chan error, 1)
+	listener, serve, _ := ListenTCP("tcp", "localhost:18110", func(conn *net.TCPConn) {
+		NewAsynSocket(NewTcpSocket(conn, NewChecksumReceiver(nil)), AsynSocketOption{
+			AutoRecv: true,
+		}).SetCloseCallback(func(_ *AsynSocket, err error) {
+			closeChan <- err
+		}).SetPacketHandler(func(_ context.Context, as *AsynSocket, packet interface{}) error {
+			recvChan <- string(packet.([]byte))
+			return nil
+		}).Recv()
+	})
+
+	go serve()
+
+	makeFrame := func(payload []byte) []byte {
+		buffs, _ := NewLengthPrefixReceiver(LengthPrefixOption{}).AppendHeader(nil, len(payload)+ChecksumSize)
+		buffs, _ = AppendChecksum(buffs, payload)
+		var frame []byte
+		for _, v := range buffs {
+			frame = append(frame, v...)
+		}
+		return frame
+	}
+
+	dialer := &net.Dialer{}
+	conn, _ := dialer.Dial("tcp", "localhost:18110")
+	s := NewTcpSocket(conn.(*net.TCPConn))
+	s.Send(makeFrame([]byte("hello")))
+	if packet := <-recvChan; packet != "hello" {
+		t.Fatal(packet)
+	}
+	frame := makeFrame([]byte("hello"))
+	frame[len(frame)-1] = 'O'
+	s.Send(frame)
+	if err := <-closeChan; err != ErrChecksumMismatch {
+		t.Fatal(err)
+	}
+	s.Close()
+	listener.Close()
+}
+
+// encode []byte as two buffers
+type splitCodec struct {
+	defaultCodec
+}
+
+func (codec *splitCodec) Encode(buffs net.Buffers, o interface{}) (net.Buffers, int) {
+	b := o.([]byte)
+	return append(buffs, b[:len(b)/2], b[len(b)/2:]), len(b)
+}
+
+func TestFragmentCodec(t *testing.T) {
+	encoder := NewFragmentCodec(FragmentOption{FragmentSize: 16, Codec: &splitCodec{}})
+	msgs := []string{"hello", strings.Repeat("a", 16), strings.Repeat("b", 100)}
+	var buffs net.Buffers
+	for _, msg := range msgs {
+		buffs, _ = encoder.Encode(buffs, []byte(msg))
+	}
+	var data []byte
+	for _, v := range buffs {
+		data = append(data, v...)
+	}
+	if len(data) != 4+5+4+16+7*(4+8)+100 {
+		t.Fatal(len(data))
+	}
+
+	{
+		decoder := NewFragmentCodec(FragmentOption{FragmentSize: 16})
+		cr := &chunkReader{data: data, chunks: []int{3, 5, 11, 2, 1}}
+		for _, msg := range msgs {
+			packet, err := decoder.Recv(cr, time.Time{})
+			if err != nil || string(packet) != msg {
+				t.Fatal(err, string(packet))
+			}
+		}
+	}
+
+	{
+		decoder := NewFragmentCodec(FragmentOption{FragmentSize: 16, MaxMessageSize: 50})
+		var tooLarge *PacketTooLargeError
+		if _, err := decoder.Recv(&chunkReader{data: data}, time.Time{}); err != nil {
+			t.Fatal(err)
+		} else if _, err = decoder.Recv(&chunkReader{data: data[9:]}, time.Time{}); err != nil {
+			t.Fatal(err)
+		} else if _, err = decoder.Recv(&chunkReader{data: data[29:]}, time.Time{}); !errors.As(err, &tooLarge) {
+			t.Fatal(err)
+		}
+	}
+
+	{
+		decoder := NewFragmentCodec(FragmentOption{FragmentSize: 16, ReassembleTimeout: time.Millisecond * 50})
+		//only the first fragment is sent,then the peer stalls
+		local, remote := net.Pipe()
+		go remote.Write(data[29 : 29+12+16])
+		begin := time.Now()
+		if _, err := decoder.Recv(local, time.Time{}); err != ErrReassembleTimeout {
+			t.Fatal(err)
+		} else if elapsed := time.Since(begin); elapsed > time.Millisecond*500 {
+			t.Fatal(elapsed)
+		}
+		local.Close()
+		remote.Close()
+	}
+
+	{
+		decoder := NewFragmentCodec(FragmentOption{FragmentSize: 16})
+		first := data[29 : 29+12+16]
+		//fragment of another message before the previous one finished
+		other := append([]byte{}, first...)
+		binary.BigEndian.PutUint32(other[4:], 100)
+		if _, err := decoder.Recv(&chunkReader{data: append(append([]byte{}, first...), other...)}, time.Time{}); err != ErrInvalidFragment {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRecvStream(t *testing.T) {
+	large := strings.Repeat("a", 100000)
+	{
+		resultChan := make(chan string, 2)
+		listener, serve, _ := ListenTCP("tcp", "localhost:18110", func(conn *net.TCPConn) {
+			s := NewTcpSocket(conn, NewLengthPrefixReceiver(LengthPrefixOption{MaxPacketSize: 100}))
+			go func() {
+				//only read part of the stream,the rest is discarded
+				err := s.(StreamReceiver).RecvStream(func(r io.Reader) error {
+					b := make([]byte, 10)
+					_, err := io.ReadFull(r, b)
+					resultChan <- string(b)
+					return err
+				})
+				if err != nil {
+					resultChan <- err.Error()
+				}
+				packet, _ := s.Recv()
+				resultChan <- string(packet)
+				s.Close()
+			}()
+		})
+
+		go serve()
+
+		dialer := &net.Dialer{}
+		conn, _ := dialer.Dial("tcp", "localhost:18110")
+		s := NewTcpSocket(conn.(*net.TCPConn))
+		r := NewLengthPrefixReceiver(LengthPrefixOption{MaxPacketSize: len(large)})
+		for _, msg := range []string{large, "next"} {
+			buffs, _ := r.AppendHeader(nil, len(msg))
+			buffs = append(buffs, []byte(msg))
+			s.(BuffersSender).SendBuffers(buffs)
+		}
+
+		if result := <-resultChan; result != large[:10] {
+			t.Fatal(result)
+		}
+		if result := <-resultChan; result != "next" {
+			t.Fatal(result)
+		}
+		s.Close()
+		listener.Close()
+	}
+
+	{
+		//Close discards the rest of the frame
+		r := NewLengthPrefixReceiver(LengthPrefixOption{})
+		var buffs net.Buffers
+		for _, msg := range []string{"hello world", "next"} {
+			buffs, _ = r.AppendHeader(buffs, len(msg))
+			buffs = append(buffs, []byte(msg))
+		}
+		var data []byte
+		for _, v := range buffs {
+			data = append(data, v...)
+		}
+		cr := &chunkReader{data: data, chunks: []int{6, 3}}
+		err := r.RecvStream(cr, time.Time{}, func(reader io.Reader) error {
+			b := make([]byte, 5)
+			if _, err := io.ReadFull(reader, b); err != nil || string(b) != "hello" {
+				return fmt.Errorf("%v %s", err, b)
+			}
+			return reader.(io.Closer).Close()
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if packet, err := r.Recv(cr, time.Time{}); err != nil || string(packet) != "next" {
+			t.Fatal(err, string(packet))
+		}
+	}
+
+	{
+		//frame rejected by handler is not drained
+		server, client := net.Pipe()
+		r := NewLengthPrefixReceiver(LengthPrefixOption{HeaderSize: 8})
+		go func() {
+			buffs, _ := NewLengthPrefixReceiver(LengthPrefixOption{HeaderSize: 8, MaxPacketSize: 1 << 40}).AppendHeader(nil, 1<<40)
+			client.Write(buffs[0])
+		}()
+		errTooLarge := errors.New("too large")
+		begin := time.Now()
+		err := r.RecvStream(server, time.Now().Add(time.Millisecond*500), func(io.Reader) error {
+			return errTooLarge
+		})
+		if err != errTooLarge || time.Since(begin) > time.Millisecond*200 {
+			t.Fatal(err, time.Since(begin))
+		}
+		server.Close()
+		client.Close()
+	}
+
+	{
+		tcpAddr, _ := net.ResolveTCPAddr("tcp", "localhost:18111")
+		listener, _ := net.ListenTCP("tcp", tcpAddr)
+		upgrader := &gorilla.Upgrader{}
+		resultChan := make(chan int, 2)
+		mux := http.NewServeMux()
+		mux.HandleFunc("/stream", func(w http.ResponseWriter, r *http.Request) {
+			conn, _ := upgrader.Upgrade(w, r, nil)
+			s := NewWebSocket(conn)
+			for i := 0; i < 2; i++ {
+				s.(StreamReceiver).RecvStream(func(r io.Reader) error {
+					n, err := io.Copy(io.Discard, r)
+					resultChan <- int(n)
+					return err
+				})
+			}
+			s.Close()
+		})
+		go http.Serve(listener, mux)
+
+		conn, _, err := gorilla.DefaultDialer.Dial("ws://localhost:18111/stream", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := NewWebSocket(conn)
+		s.Send([]byte(large))
+		s.Send([]byte("next"))
+		if n := <-resultChan; n != len(large) {
+			t.Fatal(n)
+		}
+		if n := <-resultChan; n != 4 {
+			t.Fatal(n)
+		}
+		s.Close()
+		listener.Close()
+	}
+}
+
+func TestProxyProtocol(t *testing.T) {
+	type result struct {
+		remoteAddr string
+		localAddr  string
+		packet     string
+		tlv        string
+	}
+
+	v2Header := func() []byte {
+		header := append([]byte{}, proxyV2Signature...)
+		header = append(header, 0x21, 0x11, 0, 12+3+3)
+		header = append(header, 10, 0, 0, 1, 10, 0, 0, 2, 0x1F, 0x90, 0x00, 0x50)
+		return append(header, 0x01, 0, 3, 'h', '2', 'c')
+	}
+
+	for _, c := range []struct {
+		option ProxyProtocolOption
+		header []byte
+		expect *result
+	}{
+		{
+			option: ProxyProtocolOption{},
+			header: []byte("PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n"),
+			expect: &result{remoteAddr: "192.168.0.1:56324", localAddr: "192.168.0.11:443", packet: "hello"},
+		},
+		{
+			option: ProxyProtocolOption{},
+			header: v2Header(),
+			expect: &result{remoteAddr: "10.0.0.1:8080", localAddr: "10.0.0.2:80", packet: "hello", tlv: "h2c"},
+		},
+		{
+			option: ProxyProtocolOption{Policy: ProxyOptional},
+			expect: &result{remoteAddr: "127.0.0.1", packet: "hello"},
+		},
+		{
+			option: ProxyProtocolOption{},
+		},
+		{
+			//not trusted,header is not parsed
+			option: ProxyProtocolOption{Policy: ProxyTrusted, TrustedCIDRs: []*net.IPNet{{IP: net.IP{10, 0, 0, 0}, Mask: net.CIDRMask(8, 32)}}},
+			header: []byte("PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n"),
+			expect: &result{remoteAddr: "127.0.0.1", packet: "PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\nhello"},
+		},
+	} {
+		resultChan := make(chan *result, 1)
+		listener, serve, _ := ListenTCPWithProxyProtocol("tcp", "localhost:18110", c.option, func(conn *ProxyConn) {
+			s := NewProxyTcpSocket(conn)
+			r := &result{
+				remoteAddr: s.RemoteAddr().String(),
+				localAddr:  s.LocalAddr().String(),
+			}
+			if tlv, ok := conn.TLV(0x01); ok {
+				r.tlv = string(tlv)
+			}
+			var packet []byte
+			for len(packet) < 5 {
+				b, err := s.Recv()
+				if err != nil {
+					break
+				}
+				packet = append(packet, b...)
+			}
+			r.packet = string(packet)
+			resultChan <- r
+			s.Close()
+		})
+
+		go serve()
+
+		dialer := &net.Dialer{}
+		conn, _ := dialer.Dial("tcp", "localhost:18110")
+		conn.Write(append(c.header, []byte("hello")...))
+		if c.expect == nil {
+			//bad header,closed by server
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+				t.Fatal(err)
+			}
+		} else {
+			r := <-resultChan
+			if !strings.HasPrefix(r.remoteAddr, c.expect.remoteAddr) || r.packet != c.expect.packet || r.tlv != c.expect.tlv {
+				t.Fatal(r)
+			} else if c.expect.localAddr != "" && r.localAddr != c.expect.localAddr {
+				t.Fatal(r)
+			}
+		}
+		conn.Close()
+		listener.Close()
+	}
+}
+
+// self signed certificate for localhost
+func selfSignedTLSConfig(t *testing.T) *tls.Config {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	}
+}
+
+func TestListenMux(t *testing.T) {
+	resultChan := make(chan string, 1)
+	echo := func(s Socket) {
+		go func() {
+			for {
+				packet, err := s.Recv()
+				if nil != err {
+					break
+				}
+				s.Send(packet)
+			}
+			s.Close()
+		}()
+	}
+
+	listener, serve, err := ListenMux("tcp", "localhost:18110", MuxOption{
+		SniffTimeout: time.Millisecond * 100,
+		OnTcpSocket: func(s Socket) {
+			resultChan <- "tcp"
+			echo(s)
+		},
+		OnWebSocket: func(s Socket) {
+			resultChan <- "websocket"
+			echo(s)
+		},
+		TLSConfig: selfSignedTLSConfig(t),
+		OnTLSConn: func(conn *tls.Conn) {
+			resultChan <- "tls"
+			go func() {
+				io.Copy(conn, conn)
+				conn.Close()
+			}()
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go serve()
+
+	{
+		dialer := &net.Dialer{}
+		conn, _ := dialer.Dial("tcp", "localhost:18110")
+		s := NewTcpSocket(conn.(*net.TCPConn))
+		//peeked bytes are replayed
+		s.Send([]byte("GEThello"))
+		if r := <-resultChan; r != "tcp" {
+			t.Fatal(r)
+		}
+		var packet []byte
+		for len(packet) < 8 {
+			b, _ := s.Recv()
+			packet = append(packet, b...)
+		}
+		if string(packet) != "GEThello" {
+			t.Fatal(string(packet))
+		}
+		s.Close()
+	}
+
+	{
+		//client sends nothing
+		dialer := &net.Dialer{}
+		conn, _ := dialer.Dial("tcp", "localhost:18110")
+		if r := <-resultChan; r != "tcp" {
+			t.Fatal(r)
+		}
+		conn.Close()
+	}
+
+	{
+		conn, _, err := gorilla.DefaultDialer.Dial("ws://localhost:18110/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r := <-resultChan; r != "websocket" {
+			t.Fatal(r)
+		}
+		s := NewWebSocket(conn)
+		s.Send([]byte("hello"))
+		packet, err := s.Recv()
+		if err != nil || string(packet) != "hello" {
+			t.Fatal(err, string(packet))
+		}
+		s.Close()
+	}
+
+	{
+		//ClientHello bytes read for sniffing are replayed to the handshake
+		conn, err := tls.Dial("tcp", "localhost:18110", &tls.Config{InsecureSkipVerify: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r := <-resultChan; r != "tls" {
+			t.Fatal(r)
+		}
+		conn.Write([]byte("hello"))
+		b := make([]byte, 5)
+		if _, err := io.ReadFull(conn, b); err != nil || string(b) != "hello" {
+			t.Fatal(err, string(b))
+		}
+		conn.Close()
+	}
+
+	{
+		//client stalls after "GET ",the connection is closed after SniffTimeout
+		dialer := &net.Dialer{}
+		conn, _ := dialer.Dial("tcp", "localhost:18110")
+		conn.Write([]byte("GET "))
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		begin := time.Now()
+		io.Copy(io.Discard, conn)
+		if time.Since(begin) > time.Millisecond*500 {
+			t.Fatal("stalled http connection not closed")
+		}
+		conn.Close()
+	}
+
+	listener.Close()
+}
+
+func TestProtoCodec(t *testing.T) {
+	registry := NewProtoRegistry()
+	if err := registry.Register(1, &wrapperspb.StringValue{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Register(1, &wrapperspb.Int32Value{}); err == nil {
+		t.Fatal("duplicate id")
+	}
+	if _, err := registry.RegisterByName(&wrapperspb.Int32Value{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var encodeErr error
+	codec := NewProtoCodec(ProtoCodecOption{
+		Registry: registry,
+		OnEncodeError: func(_ interface{}, err error) {
+			encodeErr = err
+		},
+	})
+
+	var buffs net.Buffers
+	buffs, _ = codec.Encode(buffs, wrapperspb.String("hello"))
+	buffs, _ = codec.Encode(buffs, wrapperspb.Int32(100))
+	if _, n := codec.Encode(buffs, wrapperspb.Bool(true)); n != 0 || encodeErr == nil {
+		t.Fatal(n, encodeErr)
+	}
+
+	var data []byte
+	for _, v := range buffs {
+		data = append(data, v...)
+	}
+
+	cr := &chunkReader{data: data, chunks: []int{3, 2}}
+	for _, expect := range []proto.Message{wrapperspb.String("hello"), wrapperspb.Int32(100)} {
+		packet, err := codec.Recv(cr, time.Time{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg, err := codec.Decode(packet)
+		if err != nil || !proto.Equal(msg.(proto.Message), expect) {
+			t.Fatal(err, msg)
+		}
+	}
+
+	var unknown *UnknownMessageIDError
+	if _, err := codec.Decode([]byte{0, 0, 0, 2}); !errors.As(err, &unknown) || unknown.ID != 2 {
+		t.Fatal(err)
+	}
+
+	//dropped object is logged by default
+	logged := &strings.Builder{}
+	log.SetOutput(logged)
+	NewProtoCodec(ProtoCodecOption{Registry: registry}).Encode(nil, wrapperspb.Bool(true))
+	log.SetOutput(os.Stderr)
+	if !strings.Contains(logged.String(), "*wrapperspb.BoolValue") {
+		t.Fatal(logged.String())
+	}
+}
+
+func TestRouter(t *testing.T) {
+	registry := NewProtoRegistry()
+	registry.Register(1, &wrapperspb.StringValue{})
+	registry.Register(2, &wrapperspb.Int32Value{})
+
+	var result []string
+	router := NewRouter().SetMessageIDResolver(registry.MessageID)
+	Handle(router, func(_ context.Context, _ *AsynSocket, msg *wrapperspb.StringValue) error {
+		result = append(result, msg.Value)
+		return nil
+	})
+	router.Register([]byte{}, func(_ context.Context, _ *AsynSocket, msg interface{}) error {
+		result = append(result, string(msg.([]byte)))
+		return nil
+	})
+	router.RegisterID(2, func(_ context.Context, _ *AsynSocket, msg interface{}) error {
+		result = append(result, "id 2")
+		return nil
+	})
+
+	for _, msg := range []interface{}{wrapperspb.String("hello"), []byte("bytes"), wrapperspb.Int32(1)} {
+		if err := router.Dispatch(context.Background(), nil, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if strings.Join(result, ",") != "hello,bytes,id 2" {
+		t.Fatal(result)
+	}
+
+	if err := router.Dispatch(context.Background(), nil, 1); err != ErrUnhandledMessage {
+		t.Fatal(err)
+	}
+
+	router.SetFallback(func(context.Context, *AsynSocket, interface{}) error {
+		return nil
+	})
+	if err := router.Dispatch(context.Background(), nil, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("interface type registered")
+			}
+		}()
+		Handle(router, func(_ context.Context, _ *AsynSocket, msg proto.Message) error {
+			return nil
+		})
+	}()
+}
+
+// length prefixed []byte
+type lengthPrefixCodec struct {
+	defaultCodec
+}
+
+func (codec *lengthPrefixCodec) Encode(buffs net.Buffers, o interface{}) (net.Buffers, int) {
+	b, ok := o.([]byte)
+	if !ok {
+		return buffs, 0
+	}
+	buffs, n := NewLengthPrefixReceiver(LengthPrefixOption{}).AppendHeader(buffs, len(b))
+	return append(buffs, b), n + len(b)
+}
+
+func TestBroadcast(t *testing.T) {
+	sockets := make(chan *AsynSocket, 3)
+	listener, serve, _ := ListenTCP("tcp", "localhost:18110", func(conn *net.TCPConn) {
+		sockets <- NewAsynSocket(NewTcpSocket(conn, NewLengthPrefixReceiver(LengthPrefixOption{})), AsynSocketOption{
+			Codec:        &lengthPrefixCodec{},
+			SendChanSize: 8,
+		})
+	})
+
+	go serve()
+
+	var clients []Socket
+	var targets []*AsynSocket
+	for i := 0; i < 3; i++ {
+		dialer := &net.Dialer{}
+		conn, _ := dialer.Dial("tcp", "localhost:18110")
+		clients = append(clients, NewTcpSocket(conn.(*net.TCPConn), NewLengthPrefixReceiver(LengthPrefixOption{})))
+		targets = append(targets, <-sockets)
+	}
+
+	failed := 0
+	err := Broadcast(&lengthPrefixCodec{}, []byte("hello"), targets, func(s *AsynSocket, err error) {
+		failed++
+	})
+	if err != nil || failed != 0 {
+		t.Fatal(err, failed)
+	}
+
+	for _, c := range clients {
+		packet, err := c.Recv(time.Now().Add(time.Second))
+		if err != nil || string(packet) != "hello" {
+			t.Fatal(string(packet), err)
+		}
+	}
+
+	if err = Broadcast(&lengthPrefixCodec{}, "not bytes", targets, nil); err != ErrEncodeFailed {
+		t.Fatal(err)
+	}
+
+	for _, s := range targets {
+		s.Close(nil)
+	}
+	for _, c := range clients {
+		c.Close()
+	}
+	listener.Close()
+}
+
+func TestGroup(t *testing.T) {
+	group := NewGroup(&lengthPrefixCodec{})
+	closeCh := make(chan *AsynSocket, 3)
+	listener, serve, _ := ListenTCP("tcp", "localhost:18110", func(conn *net.TCPConn) {
+		s := NewAsynSocket(NewTcpSocket(conn, NewLengthPrefixReceiver(LengthPrefixOption{})), AsynSocketOption{
+			Codec:        &lengthPrefixCodec{},
+			SendChanSize: 8,
+		}).SetCloseCallback(func(s *AsynSocket, _ error) {
+			closeCh <- s
+		})
+		group.Add(s)
+		s.Recv()
+	})
+
+	go serve()
+
+	var clients []Socket
+	for i := 0; i < 3; i++ {
+		dialer := &net.Dialer{}
+		conn, _ := dialer.Dial("tcp", "localhost:18110")
+		clients = append(clients, NewTcpSocket(conn.(*net.TCPConn), NewLengthPrefixReceiver(LengthPrefixOption{})))
+	}
+
+	for group.Len() != 3 {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	var first *AsynSocket
+	group.Range(func(s *AsynSocket) bool {
+		first = s
+		return false
+	})
+
+	if group.Add(first) {
+		t.Fatal("add twice")
+	}
+
+	err := group.BroadcastFilter([]byte("hello"), func(s *AsynSocket) bool {
+		return s != first
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received := 0
+	for _, c := range clients {
+		if packet, err := c.Recv(time.Now().Add(time.Millisecond * 200)); err == nil && string(packet) == "hello" {
+			received++
+		}
+	}
+	if received != 2 {
+		t.Fatal("filtered broadcast", received)
+	}
+
+	for _, c := range clients {
+		c.Close()
+	}
+
+	for i := 0; i < 3; i++ {
+		<-closeCh
+	}
+
+	if group.Len() != 0 || group.Contains(first) {
+		t.Fatal("member should be removed after closed")
+	}
+
+	if group.Add(first) {
+		t.Fatal("closed socket should not be added")
+	}
+
+	listener.Close()
+}
+
+func TestHeartbeat(t *testing.T) {
+	hb := &BytesHeartbeat{PingPacket: []byte("ping"), PongPacket: []byte("pong")}
+	serverCh := make(chan *AsynSocket, 1)
+	closeCh := make(chan error, 1)
+	listener, serve, _ := ListenTCP("tcp", "localhost:18110", func(conn *net.TCPConn) {
+		s := NewAsynSocket(NewTcpSocket(conn, NewLengthPrefixReceiver(LengthPrefixOption{})), AsynSocketOption{
+			Codec:           &lengthPrefixCodec{},
+			Heartbeat:       hb,
+			PingInterval:    time.Millisecond * 50,
+			IdleReadTimeout: time.Millisecond * 200,
+		}).SetCloseCallback(func(_ *AsynSocket, err error) {
+			closeCh <- err
+		}).SetPacketHandler(func(_ context.Context, s *AsynSocket, packet interface{}) error {
+			return errors.New("unexpected packet " + string(packet.([]byte)))
+		})
+		s.Recv()
+		serverCh <- s
+	})
+
+	go serve()
+
+	dialer := &net.Dialer{}
+	conn, _ := dialer.Dial("tcp", "localhost:18110")
+	client := NewAsynSocket(NewTcpSocket(conn.(*net.TCPConn), NewLengthPrefixReceiver(LengthPrefixOption{})), AsynSocketOption{
+		Codec:     &lengthPrefixCodec{},
+		Heartbeat: hb,
+	}).SetPacketHandler(func(_ context.Context, s *AsynSocket, packet interface{}) error {
+		return errors.New("unexpected packet " + string(packet.([]byte)))
+	}).Recv()
+
+	server := <-serverCh
+
+	time.Sleep(time.Millisecond * 300)
+
+	if server.RTT() <= 0 {
+		t.Fatal("rtt should be measured")
+	}
+
+	select {
+	case err := <-closeCh:
+		t.Fatal(err)
+	default:
+	}
+
+	//client stops answering ping
+	client.Close(nil)
+
+	if err := <-closeCh; err != ErrHeartbeatTimeout && err != io.EOF {
+		t.Fatal(err)
+	}
+
+	//idle peer without heartbeat
+	conn, _ = dialer.Dial("tcp", "localhost:18110")
+	<-serverCh
+	if err := <-closeCh; err != ErrHeartbeatTimeout {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	listener.Close()
+}
+
+func TestSendPriority(t *testing.T) {
+	s := NewAsynSocket(nil, AsynSocketOption{
+		SendChanSize:             32,
+		HighPrioritySendChanSize: 64,
+		LowPrioritySendChanSize:  32,
+	})
+
+	for i := 0; i < 32; i++ {
+		s.sendReq[PriorityLow] <- "l"
+		s.sendReq[PriorityNormal] <- "n"
+		s.sendReq[PriorityHigh] <- "h"
+	}
+
+	order := ""
+	for round := 0; round < lowPriorityRound; round++ {
+		o, _ := s.popSendReq(round)
+		order += o.(string)
+	}
+
+	if order != "hhhnhhhnhhhnhhhl" {
+		t.Fatal(order)
+	}
+
+	for s.queuedObjects() > 0 {
+		s.popSendReq(0)
+	}
+
+	dialer := &net.Dialer{}
+	recvCh := make(chan []byte, 1)
+	listener, serve, _ := ListenTCP("tcp", "localhost:18110", func(conn *net.TCPConn) {
+		go func() {
+			buff := make([]byte, 4)
+			io.ReadFull(conn, buff)
+			recvCh <- buff
+			conn.Close()
+		}()
+	})
+	go serve()
+
+	conn, _ := dialer.Dial("tcp", "localhost:18110")
+	s = NewAsynSocket(NewTcpSocket(conn.(*net.TCPConn)), AsynSocketOption{SendChanSize: 4})
+	s.sendReq[PriorityNormal] <- []byte("n")
+	s.sendReq[PriorityHigh] <- []byte("h")
+	s.sendReq[PriorityHigh] <- []byte("h")
+	s.SendPriority([]byte("l"), PriorityLow)
+
+	if b := <-recvCh; string(b) != "hhnl" {
+		t.Fatal(string(b))
+	}
+
+	s.Close(nil)
+	listener.Close()
+}
+
+func TestSendWithResult(t *testing.T) {
+	recvCh := make(chan string, 1)
+	listener, serve, _ := ListenTCP("tcp", "localhost:18110", func(conn *net.TCPConn) {
+		go func() {
+			b, _ := io.ReadAll(conn)
+			recvCh <- string(b)
+		}()
+	})
+	go serve()
+
+	dialer := &net.Dialer{}
+	conn, _ := dialer.Dial("tcp", "localhost:18110")
+	s := NewAsynSocket(NewTcpSocket(conn.(*net.TCPConn)), AsynSocketOption{SendChanSize: 8})
+
+	if err := s.SendWithResult([]byte("hello")).Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	//send reply then close
+	s.SendWithCallback([]byte(" bye"), func(err error) {
+		s.Close(err)
+	})
+
+	if b := <-recvCh; b != "hello bye" {
+		t.Fatal(b)
+	}
+
+	for i := 0; i < 10; i++ {
+		f := s.SendWithResult([]byte("closed"))
+		<-f.Done()
+		if f.Err() != ErrSocketClosed {
+			t.Fatal(f.Err())
+		}
+	}
+
+	listener.Close()
+}
+
+func TestWaterMark(t *testing.T) {
+	var events []string
+	s := NewAsynSocket(nil, AsynSocketOption{
+		HighWaterMark: 100,
+		OnWritable: func(*AsynSocket) {
+			events = append(events, "writable")
+		},
+		OnUnwritable: func(*AsynSocket) {
+			events = append(events, "unwritable")
+		},
+	})
+
+	s.addQueuedBytes(s.queuedSize(make([]byte, 60)))
+	s.addQueuedBytes(s.queuedSize(&sendRequest{o: "0123456789012345678901234567890123456789"}))
+	if s.IsWritable() || s.QueuedBytes() != 100 {
+		t.Fatal("should be unwritable", s.QueuedBytes())
+	}
+	s.addQueuedBytes(10)
+	s.addQueuedBytes(-40)
+	if s.IsWritable() {
+		t.Fatal("should be unwritable until low water mark")
+	}
+	s.addQueuedBytes(-30)
+	if !s.IsWritable() || s.QueuedBytes() != 40 {
+		t.Fatal("should be writable", s.QueuedBytes())
+	}
+
+	if strings.Join(events, ",") != "unwritable,writable" {
+		t.Fatal(events)
+	}
+
+	listener, serve, _ := ListenTCP("tcp", "localhost:18110", func(conn *net.TCPConn) {
+		go io.Copy(io.Discard, conn)
+	})
+	go serve()
+
+	dialer := &net.Dialer{}
+	conn, _ := dialer.Dial("tcp", "localhost:18110")
+	s = NewAsynSocket(NewTcpSocket(conn.(*net.TCPConn)), AsynSocketOption{SendChanSize: 64, HighWaterMark: 1024})
+	for i := 0; i < 64; i++ {
+		s.Send(make([]byte, 512))
+	}
+	s.SendWithResult([]byte("end")).Wait(context.Background())
+	if s.QueuedBytes() != 0 || s.QueuedObjects() != 0 || !s.IsWritable() {
+		t.Fatal("queue should be empty", s.QueuedBytes(), s.QueuedObjects())
+	}
+
+	s.Close(nil)
+	listener.Close()
+}
+
+func TestShutdown(t *testing.T) {
+	connCh := make(chan *net.TCPConn, 1)
+	listener, serve, _ := ListenTCP("tcp", "localhost:18110", func(conn *net.TCPConn) {
+		connCh <- conn
+	})
+	go serve()
+
+	dialer := &net.Dialer{}
+	conn, _ := dialer.Dial("tcp", "localhost:18110")
+	s := NewAsynSocket(NewTcpSocket(conn.(*net.TCPConn)), AsynSocketOption{SendChanSize: 64})
+	peer := <-connCh
+	for i := 0; i < 8; i++ {
+		s.Send([]byte("hello"))
+	}
+
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if b, _ := io.ReadAll(peer); len(b) != 40 {
+		t.Fatal(len(b))
+	}
+
+	select {
+	case <-s.Done():
+	default:
+		t.Fatal("should be done")
+	}
+
+	if s.Send([]byte("hello")) != ErrSocketClosed {
+		t.Fatal("send after shutdown")
+	}
+
+	//peer doesn't read,shutdown is bounded by ctx
+	conn, _ = dialer.Dial("tcp", "localhost:18110")
+	s = NewAsynSocket(NewTcpSocket(conn.(*net.TCPConn)), AsynSocketOption{SendChanSize: 64})
+	peer = <-connCh
+	var lastResult *SendFuture
+	for i := 0; i < 64; i++ {
+		lastResult = s.SendWithResult(make([]byte, 1024*1024))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatal(err)
+	}
+
+	if lastResult.Err() == nil {
+		t.Fatal("last object should not be written")
+	}
+
+	peer.Close()
+	listener.Close()
+}
+
+func TestCloseWrite(t *testing.T) {
+	onPeer := func(conn net.Conn) {
+		go func() {
+			b, _ := io.ReadAll(conn)
+			conn.Write([]byte("got " + string(b)))
+			conn.Close()
+		}()
+	}
+
+	listener, serve, _ := ListenTCP("tcp", "localhost:18110", func(conn *net.TCPConn) {
+		onPeer(conn)
+	})
+	go serve()
+
+	dialer := &net.Dialer{}
+	conn, _ := dialer.Dial("tcp", "localhost:18110")
+	recvCh := make(chan string, 1)
+	closeCh := make(chan error, 1)
+	s := NewAsynSocket(NewTcpSocket(conn.(*net.TCPConn)), AsynSocketOption{SendChanSize: 8}).SetPacketHandler(func(_ context.Context, s *AsynSocket, packet interface{}) error {
+		recvCh <- string(packet.([]byte))
+		s.Recv()
+		return nil
+	}).SetCloseCallback(func(_ *AsynSocket, err error) {
+		closeCh <- err
+	}).Recv()
+
+	s.Send([]byte("hello"))
+	s.Send([]byte(" world"))
+	if err := s.CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Send([]byte("!")); err != ErrWriteClosed {
+		t.Fatal(err)
+	}
+
+	if b := <-recvCh; b != "got hello world" {
+		t.Fatal(b)
+	}
+
+	if err := <-closeCh; err != io.EOF {
+		t.Fatal(err)
+	}
+
+	{
+		//CloseWrite before Recv,reply is delayed longer than heartbeat timeout
+		conn, _ := dialer.Dial("tcp", "localhost:18110")
+		s := NewAsynSocket(NewTcpSocket(conn.(*net.TCPConn)), AsynSocketOption{
+			SendChanSize: 8,
+			Heartbeat:    &BytesHeartbeat{PingPacket: []byte("ping"), PongPacket: []byte("pong")},
+			PingInterval: time.Millisecond * 30,
+		}).SetPacketHandler(func(_ context.Context, s *AsynSocket, packet interface{}) error {
+			recvCh <- string(packet.([]byte))
+			return nil
+		}).SetCloseCallback(func(_ *AsynSocket, err error) {
+			closeCh <- err
+		})
+		s.Send([]byte("hello"))
+		if err := s.CloseWrite(); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond * 150)
+		select {
+		case err := <-closeCh:
+			t.Fatal("closed after CloseWrite", err)
+		default:
+		}
+		s.Recv()
+		if b := <-recvCh; b != "got hello" {
+			t.Fatal(b)
+		}
+		s.Close(nil)
+		<-closeCh
+	}
+
+	listener.Close()
+
+	//unix socket
+	path := filepath.Join(t.TempDir(), "netgo.sock")
+	listener, serve, _ = ListenUnix("unix", path, func(conn *net.UnixConn) {
+		onPeer(conn)
+	})
+	go serve()
+
+	conn, _ = dialer.Dial("unix", path)
+	us := NewUnixSocket(conn.(*net.UnixConn))
+	us.Send([]byte("hello"))
+	if err := us.(CloseWriter).CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+
+	if b, err := us.Recv(time.Now().Add(time.Second)); err != nil || string(b) != "got hello" {
+		t.Fatal(string(b), err)
+	}
+
+	us.Close()
+	listener.Close()
+
+	//smux stream has no half close
+	if NewStream(&smux.Stream{}).(CloseWriter).CanCloseWrite() {
+		t.Fatal("smux stream should not support CloseWrite")
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	l := NewRateLimiter(1000, 100)
+	if d := l.reserve(100); d != 0 {
+		t.Fatal(d)
+	}
+	//debt is allowed
+	if d := l.reserve(100); d < time.Millisecond*90 || d > time.Millisecond*110 {
+		t.Fatal(d)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := l.Wait(ctx, 100); err != context.Canceled {
+		t.Fatal(err)
+	}
+
+	l.SetLimit(0, 0)
+	if d := l.reserve(1 << 20); d != 0 {
+		t.Fatal(d)
+	}
+
+	listener, serve, _ := ListenTCP("tcp", "localhost:18110", func(conn *net.TCPConn) {
+		go io.Copy(io.Discard, conn)
+	})
+	go serve()
+
+	dialer := &net.Dialer{}
+	conn, _ := dialer.Dial("tcp", "localhost:18110")
+	shared := NewRateLimiter(10*1024, 1024)
+	s := NewAsynSocket(NewTcpSocket(conn.(*net.TCPConn)), AsynSocketOption{
+		SendChanSize: 8,
+		SendLimiter:  shared,
+	})
+
+	begin := time.Now()
+	for i := 0; i < 3; i++ {
+		s.SendWithResult(make([]byte, 1024)).Wait(context.Background())
+	}
+	if elapsed := time.Since(begin); elapsed < time.Millisecond*150 {
+		t.Fatal("should be throttled", elapsed)
+	}
+
+	//queue is still throttled after close,Shutdown drops the rest when ctx done
+	for i := 0; i < 8; i++ {
+		s.Send(make([]byte, 2*1024))
+	}
+	begin = time.Now()
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond*300)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != context.DeadlineExceeded || time.Since(begin) > time.Millisecond*500 {
+		t.Fatal(err, time.Since(begin))
+	}
+
+	//the shared budget is not blown by the dropped objects
+	if d := shared.reserve(0); d > time.Millisecond*300 {
+		t.Fatal("shared limiter in debt", d)
+	}
+
+	conn, _ = dialer.Dial("tcp", "localhost:18110")
+	ls := NewRateLimitedSocket(NewTcpSocket(conn.(*net.TCPConn)), NewRateLimiter(1024, 1024), nil)
+	ls.Send(make([]byte, 1024))
+	if _, err := ls.Send(make([]byte, 1024), time.Now().Add(time.Millisecond*10)); !IsNetTimeoutError(err) {
+		t.Fatal(err)
+	}
+
+	//Close interrupts a throttled Send
+	go func() {
+		time.Sleep(time.Millisecond * 50)
+		ls.Close()
+	}()
+	begin = time.Now()
+	if _, err := ls.Send(make([]byte, 1024)); err != ErrSocketClosed || time.Since(begin) > time.Millisecond*500 {
+		t.Fatal(err, time.Since(begin))
+	}
+	listener.Close()
+
+	//RecvStream is forwarded and charged,including the discarded bytes
+	listener, serve, _ = ListenTCP("tcp", "localhost:18111", func(conn *net.TCPConn) {
+		buffs, _ := NewLengthPrefixReceiver(LengthPrefixOption{}).AppendHeader(nil, 2048)
+		buffs = append(buffs, make([]byte, 2048))
+		buffs.WriteTo(conn)
+	})
+	go serve()
+
+	conn, _ = dialer.Dial("tcp", "localhost:18111")
+	recvLimiter := NewRateLimiter(1024, 1024)
+	ls = NewRateLimitedSocket(NewTcpSocket(conn.(*net.TCPConn), NewLengthPrefixReceiver(LengthPrefixOption{})), nil, recvLimiter)
+	begin = time.Now()
+	err := ls.(StreamReceiver).RecvStream(func(r io.Reader) error {
+		_, err := io.ReadFull(r, make([]byte, 512))
+		return err
+	}, time.Now().Add(time.Second*3))
+	if err != nil || time.Since(begin) < time.Millisecond*900 {
+		t.Fatal("stream bytes not charged", err, time.Since(begin))
+	}
+	ls.Close()
+	listener.Close()
+}
+
+func TestStats(t *testing.T) {
+	connCh := make(chan *net.TCPConn, 1)
+	listener, serve, _ := ListenTCP("tcp", "localhost:18110", func(conn *net.TCPConn) {
+		connCh <- conn
+	})
+	go serve()
+
+	dialer := &net.Dialer{}
+	conn, _ := dialer.Dial("tcp", "localhost:18110")
+	s := NewAsynSocket(NewTcpSocket(conn.(*net.TCPConn)), AsynSocketOption{
+		SendChanSize: 16,
+		Codec:        &lengthPrefixCodec{},
+	})
+	server := NewTcpSocket(<-connCh, NewLengthPrefixReceiver(LengthPrefixOption{}))
+
+	var last *SendFuture
+	for i := 0; i < 10; i++ {
+		last = s.SendWithResult([]byte("hello"))
+	}
+	last.Wait(context.Background())
+
+	for i := 0; i < 10; i++ {
+		if _, err := server.Recv(time.Now().Add(time.Second)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	st := s.Stats()
+	if st.PacketsSent != 10 || st.BytesSent != 90 || st.SendCalls == 0 || st.SendCalls > 10 || st.LastWrite.IsZero() || !st.LastRead.IsZero() || st.Age <= 0 {
+		t.Fatal(st)
+	}
+
+	if st.AvgBatchSize() < 1 {
+		t.Fatal(st.AvgBatchSize())
+	}
+
+	st = server.(StatsReporter).Stats()
+	if st.PacketsRecv != 10 || st.BytesRecv != 90 || st.LastRead.IsZero() || st.BytesSent != 0 {
+		t.Fatal(st)
+	}
+
+	server.Close()
+	s.Close(nil)
+	listener.Close()
+}
+
+func TestExecutor(t *testing.T) {
+	executor := NewExecutor(ExecutorOption{Workers: 2, QueueSize: 64})
+	defer executor.Stop()
+
+	var (
+		mu       sync.Mutex
+		received = map[string][]string{}
+	)
+	doneCh := make(chan struct{}, 2)
+	listener, serve, _ := ListenTCP("tcp", "localhost:18110", func(conn *net.TCPConn) {
+		NewAsynSocket(NewTcpSocket(conn, NewLengthPrefixReceiver(LengthPrefixOption{})), AsynSocketOption{
+			AutoRecv:        true,
+			Executor:        executor,
+			MaxPendingTasks: 2,
+		}).SetPacketHandler(func(_ context.Context, s *AsynSocket, packet interface{}) error {
+			if n := s.tasks.pending(); n > 2 {
+				return fmt.Errorf("too many pending tasks %d", n)
+			}
+			msg := string(packet.([]byte))
+			if strings.HasPrefix(msg, "slow") {
+				time.Sleep(time.Millisecond * 10)
+			}
+			mu.Lock()
+			received[msg[:4]] = append(received[msg[:4]], msg)
+			if len(received[msg[:4]]) == 20 {
+				doneCh <- struct{}{}
+			}
+			mu.Unlock()
+			return nil
+		}).Recv()
+	})
+	go serve()
+
+	send := func(prefix string) Socket {
+		dialer := &net.Dialer{}
+		conn, _ := dialer.Dial("tcp", "localhost:18110")
+		s := NewTcpSocket(conn.(*net.TCPConn))
+		codec := &lengthPrefixCodec{}
+		for i := 0; i < 20; i++ {
+			buffs, _ := codec.Encode(nil, []byte(fmt.Sprintf("%s%02d", prefix, i)))
+			s.(BuffersSender).SendBuffers(buffs)
+		}
+		return s
+	}
+
+	begin := time.Now()
+	slow := send("slow")
+	fast := send("fast")
+
+	<-doneCh
+	//fast socket is not blocked by the slow one
+	if time.Since(begin) > time.Millisecond*150 {
+		t.Fatal("fast socket blocked", time.Since(begin))
+	}
+	<-doneCh
+
+	for prefix, msgs := range received {
+		for i, msg := range msgs {
+			if msg != fmt.Sprintf("%s%02d", prefix, i) {
+				t.Fatal("out of order", msgs)
+			}
+		}
+	}
+
+	slow.Close()
+	fast.Close()
+	listener.Close()
+}
+
+func TestExecutorClose(t *testing.T) {
+	executor := NewExecutor(ExecutorOption{Workers: 2})
+	defer executor.Stop()
+
+	resultCh := make(chan []string, 1)
+	listener, serve, _ := ListenTCP("tcp", "localhost:18110", func(conn *net.TCPConn) {
+		var result []string
+		NewAsynSocket(NewTcpSocket(conn, NewLengthPrefixReceiver(LengthPrefixOption{})), AsynSocketOption{
+			AutoRecv: true,
+			ZeroCopy: true,
+			Executor: executor,
+		}).SetPacketHandler(func(_ context.Context, s *AsynSocket, packet interface{}) error {
+			//slower than recvloop,buffer of the next packet is read before the handler runs
+			time.Sleep(time.Millisecond * 20)
+			result = append(result, string(packet.([]byte)))
+			return nil
+		}).SetCloseCallback(func(_ *AsynSocket, _ error) {
+			resultCh <- append(result, "closed")
+		}).Recv()
+	})
+	go serve()
+
+	dialer := &net.Dialer{}
+	conn, _ := dialer.Dial("tcp", "localhost:18110")
+	s := NewTcpSocket(conn.(*net.TCPConn))
+	codec := &lengthPrefixCodec{}
+	for _, v := range []string{"msg0", "msg1", "msg2"} {
+		buffs, _ := codec.Encode(nil, []byte(v))
+		s.(BuffersSender).SendBuffers(buffs)
+	}
+	s.Close()
+
+	select {
+	case result := <-resultCh:
+		if fmt.Sprint(result) != "[msg0 msg1 msg2 closed]" {
+			t.Fatal(result)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("close callback not called")
+	}
+
+	listener.Close()
+}
+
+func TestExecutorStop(t *testing.T) {
+	executor := NewExecutor(ExecutorOption{Workers: 1})
+
+	block := make(chan struct{})
+	defer close(block)
+
+	socketCh := make(chan *AsynSocket, 1)
+	listener, serve, _ := ListenTCP("tcp", "localhost:18110", func(conn *net.TCPConn) {
+		s := NewAsynSocket(NewTcpSocket(conn, NewLengthPrefixReceiver(LengthPrefixOption{})), AsynSocketOption{
+			AutoRecv:        true,
+			Executor:        executor,
+			MaxPendingTasks: 1,
+		}).SetPacketHandler(func(_ context.Context, s *AsynSocket, packet interface{}) error {
+			<-block
+			return nil
+		})
+		s.Recv()
+		socketCh <- s
+	})
+	go serve()
+
+	dialer := &net.Dialer{}
+	conn, _ := dialer.Dial("tcp", "localhost:18110")
+	s := NewTcpSocket(conn.(*net.TCPConn))
+	codec := &lengthPrefixCodec{}
+	for i := 0; i < 3; i++ {
+		buffs, _ := codec.Encode(nil, []byte("hello"))
+		s.(BuffersSender).SendBuffers(buffs)
+	}
+
+	as := <-socketCh
+	time.Sleep(time.Millisecond * 50)
+	//recvloop is paused by the blocked handler
+	executor.Stop()
+
+	select {
+	case <-as.Done():
+		if as.Err() != ErrExecutorStopped {
+			t.Fatal(as.Err())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("paused socket not closed after executor stopped")
+	}
+
+	s.Close()
+	listener.Close()
+}
+
+func TestExecutorShutdown(t *testing.T) {
+	executor := NewExecutor(ExecutorOption{Workers: 1})
+	defer executor.Stop()
+
+	block := make(chan struct{})
+	defer close(block)
+
+	running := make(chan struct{}, 1)
+	socketCh := make(chan *AsynSocket, 1)
+	listener, serve, _ := ListenTCP("tcp", "localhost:18110", func(conn *net.TCPConn) {
+		s := NewAsynSocket(NewTcpSocket(conn, NewLengthPrefixReceiver(LengthPrefixOption{})), AsynSocketOption{
+			AutoRecv: true,
+			Executor: executor,
+		}).SetPacketHandler(func(_ context.Context, s *AsynSocket, packet interface{}) error {
+			running <- struct{}{}
+			//e.g. stuck on a slow database call
+			<-block
+			return nil
+		})
+		s.Recv()
+		socketCh <- s
+	})
+	go serve()
+
+	dialer := &net.Dialer{}
+	conn, _ := dialer.Dial("tcp", "localhost:18110")
+	s := NewTcpSocket(conn.(*net.TCPConn))
+	buffs, _ := (&lengthPrefixCodec{}).Encode(nil, []byte("hello"))
+	s.(BuffersSender).SendBuffers(buffs)
+
+	as := <-socketCh
+	<-running
+
+	//Shutdown gives up waiting for the blocked handler after ctx is done
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	begin := time.Now()
+	if err := as.Shutdown(ctx); err != context.DeadlineExceeded || time.Since(begin) > time.Millisecond*500 {
+		t.Fatal(err, time.Since(begin))
+	}
+
+	s.Close()
+	listener.Close()
+}
+
+// count packets received and released
+type releaseCountSocket struct {
+	Socket
+	recv     int32
+	released int32
+}
+
+func (s *releaseCountSocket) Recv(deadline ...time.Time) ([]byte, error) {
+	packet, err := s.Socket.Recv(deadline...)
+	if err == nil {
+		atomic.AddInt32(&s.recv, 1)
+	}
+	return packet, err
+}
+
+func (s *releaseCountSocket) ReleasePacket(packet []byte) {
+	atomic.AddInt32(&s.released, 1)
+	s.Socket.(PacketReleaser).ReleasePacket(packet)
+}
+
+func TestReleasePacket(t *testing.T) {
+	for _, zeroCopy := range []bool{false, true} {
+		connCh := make(chan *net.TCPConn, 1)
+		listener, serve, _ := ListenTCP("tcp", "localhost:18110", func(conn *net.TCPConn) {
+			connCh <- conn
+		})
+		go serve()
+
+		dialer := &net.Dialer{}
+		conn, _ := dialer.Dial("tcp", "localhost:18110")
+		rs := &releaseCountSocket{Socket: NewTcpSocket(<-connCh)}
+		recvCh := make(chan string, 1)
+		zeroCopy := zeroCopy
+		as := NewAsynSocket(rs, AsynSocketOption{
+			ZeroCopy:  zeroCopy,
+			Heartbeat: &BytesHeartbeat{PingPacket: []byte("ping"), PongPacket: []byte("pong")},
+		}).SetPacketHandler(func(_ context.Context, s *AsynSocket, packet interface{}) error {
+			msg := string(packet.([]byte))
+			if zeroCopy {
+				s.ReleasePacket(packet.([]byte))
+			}
+			recvCh <- msg
+			s.Recv()
+			return nil
+		}).Recv()
+
+		//pong is consumed as heartbeat
+		conn.Write([]byte("pong"))
+		time.Sleep(time.Millisecond * 50)
+		conn.Write([]byte("hello"))
+		if b := <-recvCh; b != "hello" {
+			t.Fatal(b)
+		}
+
+		if recv, released := atomic.LoadInt32(&rs.recv), atomic.LoadInt32(&rs.released); recv != 2 || released != 2 {
+			t.Fatal(zeroCopy, recv, released)
+		}
+
+		as.Close(nil)
+		conn.Close()
+		listener.Close()
+	}
+}
+
+func TestHeartbeatIdleWritePing(t *testing.T) {
+	hb := &BytesHeartbeat{PingPacket: []byte("ping"), PongPacket: []byte("pong")}
+	closeCh := make(chan error, 1)
+	listener, serve, _ := ListenTCP("tcp", "localhost:18110", func(conn *net.TCPConn) {
+		NewAsynSocket(NewTcpSocket(conn, NewLengthPrefixReceiver(LengthPrefixOption{})), AsynSocketOption{
+			Codec:            &lengthPrefixCodec{},
+			Heartbeat:        hb,
+			PingInterval:     time.Millisecond * 100,
+			IdleWriteTimeout: time.Millisecond * 80,
+		}).SetCloseCallback(func(_ *AsynSocket, err error) {
+			closeCh <- err
+		}).Recv()
+	})
+	go serve()
+
+	//peer answers ping with delay
+	dialer := &net.Dialer{}
+	conn, _ := dialer.Dial("tcp", "localhost:18110")
+	client := NewTcpSocket(conn.(*net.TCPConn), NewLengthPrefixReceiver(LengthPrefixOption{}))
+	go func() {
+		codec := &lengthPrefixCodec{}
+		for {
+			packet, err := client.Recv()
+			if err != nil {
+				return
+			} else if string(packet) == "ping" {
+				time.Sleep(time.Millisecond * 40)
+				buffs, _ := codec.Encode(nil, []byte("pong"))
+				client.(BuffersSender).SendBuffers(buffs)
+			}
+		}
+	}()
+
+	select {
+	case err := <-closeCh:
+		t.Fatal("healthy socket closed", err)
+	case <-time.After(time.Millisecond * 600):
+	}
+
+	client.Close()
+	listener.Close()
+}
@@ -0,0 +1,171 @@
+package netgo
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+var (
+	ErrNotProtoMessage error = errors.New("notProtoMessage")
+)
+
+type UnknownMessageIDError struct {
+	ID uint32
+}
+
+func (e *UnknownMessageIDError) Error() string {
+	return fmt.Sprintf("unknown message id:%d", e.ID)
+}
+
+type UnknownMessageTypeError struct {
+	Name protoreflect.FullName
+}
+
+func (e *UnknownMessageTypeError) Error() string {
+	return fmt.Sprintf("unknown message type:%s", e.Name)
+}
+
+// maps message IDs to protobuf message types,safe for concurrent use
+type ProtoRegistry struct {
+	sync.RWMutex
+	byID   map[uint32]protoreflect.MessageType
+	byName map[protoreflect.FullName]uint32
+}
+
+func NewProtoRegistry() *ProtoRegistry {
+	return &ProtoRegistry{
+		byID:   map[uint32]protoreflect.MessageType{},
+		byName: map[protoreflect.FullName]uint32{},
+	}
+}
+
+func (r *ProtoRegistry) Register(id uint32, msg proto.Message) error {
+	mt := msg.ProtoReflect().Type()
+	name := mt.Descriptor().FullName()
+	r.Lock()
+	defer r.Unlock()
+	if old, ok := r.byID[id]; ok && old.Descriptor().FullName() != name {
+		return fmt.Errorf("message id %d already registered by %s", id, old.Descriptor().FullName())
+	} else if oldID, ok := r.byName[name]; ok && oldID != id {
+		return fmt.Errorf("message %s already registered with id %d", name, oldID)
+	}
+	r.byID[id] = mt
+	r.byName[name] = id
+	return nil
+}
+
+// register with the fnv-1a hash of the full message name as id
+func (r *ProtoRegistry) RegisterByName(msg proto.Message) (uint32, error) {
+	h := fnv.New32a()
+	h.Write([]byte(msg.ProtoReflect().Descriptor().FullName()))
+	id := h.Sum32()
+	return id, r.Register(id, msg)
+}
+
+func (r *ProtoRegistry) MessageID(o interface{}) (uint32, bool) {
+	if msg, ok := o.(proto.Message); ok {
+		r.RLock()
+		id, ok := r.byName[msg.ProtoReflect().Descriptor().FullName()]
+		r.RUnlock()
+		return id, ok
+	}
+	return 0, false
+}
+
+// marshal message as [id:4][body]
+func (r *ProtoRegistry) Marshal(o interface{}) ([]byte, error) {
+	msg, ok := o.(proto.Message)
+	if !ok {
+		return nil, ErrNotProtoMessage
+	}
+	id, ok := r.MessageID(msg)
+	if !ok {
+		return nil, &UnknownMessageTypeError{Name: msg.ProtoReflect().Descriptor().FullName()}
+	}
+	b := make([]byte, 4, 4+proto.Size(msg))
+	binary.BigEndian.PutUint32(b, id)
+	return proto.MarshalOptions{}.MarshalAppend(b, msg)
+}
+
+// unmarshal [id:4][body] to the registered message type
+func (r *ProtoRegistry) Unmarshal(b []byte) (interface{}, error) {
+	if len(b) < 4 {
+		return nil, ErrInvalidPacketLength
+	}
+	id := binary.BigEndian.Uint32(b)
+	r.RLock()
+	mt, ok := r.byID[id]
+	r.RUnlock()
+	if !ok {
+		return nil, &UnknownMessageIDError{ID: id}
+	}
+	msg := mt.New().Interface()
+	if err := proto.Unmarshal(b[4:], msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+type ProtoCodecOption struct {
+	Registry      *ProtoRegistry
+	MaxPacketSize int                      //default 65535
+	OnEncodeError func(interface{}, error) //called when object is dropped by Encode,e.g. type not registered,default LogEncodeError
+}
+
+// default OnEncodeError of ProtoCodec,log the dropped object
+func LogEncodeError(o interface{}, err error) {
+	log.Printf("netgo: ProtoCodec drops %T:%v", o, err)
+}
+
+// ObjCodec and PacketReceiver for protobuf messages,packet is [len:4][id:4][body]
+//
+// ProtoCodec keeps receiving state,one codec per socket,registry could be shared.
+type ProtoCodec struct {
+	*LengthPrefixReceiver
+	registry      *ProtoRegistry
+	onEncodeError func(interface{}, error)
+}
+
+func NewProtoCodec(option ProtoCodecOption) *ProtoCodec {
+	if option.Registry == nil {
+		option.Registry = NewProtoRegistry()
+	}
+	if option.OnEncodeError == nil {
+		option.OnEncodeError = LogEncodeError
+	}
+	return &ProtoCodec{
+		LengthPrefixReceiver: NewLengthPrefixReceiver(LengthPrefixOption{MaxPacketSize: option.MaxPacketSize}),
+		registry:             option.Registry,
+		onEncodeError:        option.OnEncodeError,
+	}
+}
+
+func (codec *ProtoCodec) Registry() *ProtoRegistry {
+	return codec.registry
+}
+
+func (codec *ProtoCodec) Encode(buffs net.Buffers, o interface{}) (net.Buffers, int) {
+	b, err := codec.registry.Marshal(o)
+	if err != nil {
+		codec.onEncodeError(o, err)
+		return buffs, 0
+	}
+	buffs, n := codec.AppendHeader(buffs, len(b))
+	if n == 0 {
+		codec.onEncodeError(o, &PacketTooLargeError{Size: uint64(len(b)), MaxSize: codec.maxPacketSize})
+		return buffs, 0
+	}
+	return append(buffs, b), n + len(b)
+}
+
+func (codec *ProtoCodec) Decode(b []byte) (interface{}, error) {
+	return codec.registry.Unmarshal(b)
+}
@@ -0,0 +1,295 @@
+package netgo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidProxyHeader error = errors.New("invalidProxyHeader")
+)
+
+var (
+	proxyV1Prefix    = []byte("PROXY ")
+	proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+const proxyV1MaxLength int = 107
+
+type ProxyPolicy int
+
+const (
+	ProxyRequire  ProxyPolicy = iota //PROXY header is required
+	ProxyOptional                    //PROXY header is parsed if present
+	ProxyTrusted                     //PROXY header is required from TrustedCIDRs,connection from others is used as is
+)
+
+type ProxyProtocolOption struct {
+	Policy        ProxyPolicy
+	TrustedCIDRs  []*net.IPNet  //used by ProxyTrusted
+	HeaderTimeout time.Duration //timeout of reading PROXY header,default 5 seconds
+}
+
+// type-length-value of PROXY protocol v2
+type ProxyTLV struct {
+	Type  byte
+	Value []byte
+}
+
+// TCP connection accepted behind a load balancer using PROXY protocol v1/v2
+//
+// LocalAddr/RemoteAddr report the original addresses carried by the PROXY header
+type ProxyConn struct {
+	*net.TCPConn
+	pending    []byte //data received after the header,returned before reading from TCPConn
+	localAddr  net.Addr
+	remoteAddr net.Addr
+	tlvs       []ProxyTLV
+}
+
+func (c *ProxyConn) Read(b []byte) (int, error) {
+	if len(c.pending) > 0 {
+		n := copy(b, c.pending)
+		c.pending = c.pending[n:]
+		return n, nil
+	}
+	return c.TCPConn.Read(b)
+}
+
+func (c *ProxyConn) LocalAddr() net.Addr {
+	if c.localAddr != nil {
+		return c.localAddr
+	}
+	return c.TCPConn.LocalAddr()
+}
+
+func (c *ProxyConn) RemoteAddr() net.Addr {
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.TCPConn.RemoteAddr()
+}
+
+// TLVs of PROXY protocol v2 header
+func (c *ProxyConn) TLVs() []ProxyTLV {
+	return c.tlvs
+}
+
+func (c *ProxyConn) TLV(typ byte) ([]byte, bool) {
+	for _, v := range c.tlvs {
+		if v.Type == typ {
+			return v.Value, true
+		}
+	}
+	return nil, false
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func isTrusted(addr net.Addr, trustedCIDRs []*net.IPNet) bool {
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok {
+		for _, v := range trustedCIDRs {
+			if v.Contains(tcpAddr.IP) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// read more data until len(buff) >= n
+func readAtLeast(conn *net.TCPConn, buff []byte, n int) ([]byte, error) {
+	b := make([]byte, 256)
+	for len(buff) < n {
+		l, err := conn.Read(b)
+		buff = append(buff, b[:l]...)
+		if err != nil && len(buff) < n {
+			return buff, err
+		}
+	}
+	return buff, nil
+}
+
+func parseProxyV1(conn *ProxyConn, line string) error {
+	fields := strings.Split(line, " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil
+	} else if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return ErrInvalidProxyHeader
+	}
+
+	srcIP := net.ParseIP(fields[2])
+	dstIP := net.ParseIP(fields[3])
+	srcPort, err1 := strconv.ParseUint(fields[4], 10, 16)
+	dstPort, err2 := strconv.ParseUint(fields[5], 10, 16)
+	if srcIP == nil || dstIP == nil || err1 != nil || err2 != nil {
+		return ErrInvalidProxyHeader
+	}
+
+	conn.remoteAddr = &net.TCPAddr{IP: srcIP, Port: int(srcPort)}
+	conn.localAddr = &net.TCPAddr{IP: dstIP, Port: int(dstPort)}
+	return nil
+}
+
+func parseProxyV2(conn *ProxyConn, command byte, family byte, payload []byte) error {
+	var addrLen int
+	switch family >> 4 {
+	case 0x1:
+		addrLen = 12
+	case 0x2:
+		addrLen = 36
+	case 0x3:
+		addrLen = 216
+	default:
+		addrLen = 0
+	}
+
+	if len(payload) < addrLen {
+		return ErrInvalidProxyHeader
+	}
+
+	if command == 0x1 && (family == 0x11 || family == 0x21) {
+		ipLen := addrLen/2 - 2
+		conn.remoteAddr = &net.TCPAddr{
+			IP:   net.IP(append([]byte{}, payload[:ipLen]...)),
+			Port: int(binary.BigEndian.Uint16(payload[2*ipLen:])),
+		}
+		conn.localAddr = &net.TCPAddr{
+			IP:   net.IP(append([]byte{}, payload[ipLen:2*ipLen]...)),
+			Port: int(binary.BigEndian.Uint16(payload[2*ipLen+2:])),
+		}
+	}
+
+	for tlvs := payload[addrLen:]; len(tlvs) > 0; {
+		if len(tlvs) < 3 {
+			return ErrInvalidProxyHeader
+		}
+		l := int(binary.BigEndian.Uint16(tlvs[1:]))
+		if len(tlvs) < 3+l {
+			return ErrInvalidProxyHeader
+		}
+		conn.tlvs = append(conn.tlvs, ProxyTLV{
+			Type:  tlvs[0],
+			Value: append([]byte{}, tlvs[3:3+l]...),
+		})
+		tlvs = tlvs[3+l:]
+	}
+
+	return nil
+}
+
+// read PROXY protocol v1/v2 header from conn
+func ReadProxyHeader(conn *net.TCPConn, option ProxyProtocolOption) (*ProxyConn, error) {
+	pc := &ProxyConn{TCPConn: conn}
+	required := option.Policy == ProxyRequire
+	if option.Policy == ProxyTrusted {
+		if !isTrusted(conn.RemoteAddr(), option.TrustedCIDRs) {
+			return pc, nil
+		}
+		required = true
+	}
+
+	if option.HeaderTimeout <= 0 {
+		option.HeaderTimeout = time.Second * 5
+	}
+	conn.SetReadDeadline(time.Now().Add(option.HeaderTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	var (
+		buff []byte
+		err  error
+	)
+
+	//noHeader: data received is not a PROXY header
+	noHeader := func() (*ProxyConn, error) {
+		if required {
+			return nil, ErrInvalidProxyHeader
+		}
+		pc.pending = buff
+		return pc, nil
+	}
+
+	if buff, err = readAtLeast(conn, buff, 1); err != nil {
+		if !required && IsNetTimeoutError(err) {
+			//server first protocol,client sends nothing
+			return noHeader()
+		}
+		return nil, err
+	}
+
+	switch buff[0] {
+	case proxyV1Prefix[0]:
+		for {
+			if !bytes.HasPrefix(buff, proxyV1Prefix[:minInt(len(buff), len(proxyV1Prefix))]) {
+				return noHeader()
+			} else if i := bytes.Index(buff, []byte("\r\n")); i >= 0 && i+2 <= proxyV1MaxLength {
+				pc.pending = buff[i+2:]
+				if err = parseProxyV1(pc, string(buff[:i])); err != nil {
+					return nil, err
+				}
+				return pc, nil
+			} else if len(buff) >= proxyV1MaxLength {
+				return nil, ErrInvalidProxyHeader
+			} else if buff, err = readAtLeast(conn, buff, len(buff)+1); err != nil {
+				return nil, err
+			}
+		}
+	case proxyV2Signature[0]:
+		for len(buff) < 16 {
+			if !bytes.HasPrefix(proxyV2Signature, buff[:minInt(len(buff), len(proxyV2Signature))]) {
+				return noHeader()
+			} else if buff, err = readAtLeast(conn, buff, len(buff)+1); err != nil {
+				return nil, err
+			}
+		}
+
+		if !bytes.HasPrefix(buff, proxyV2Signature) {
+			return noHeader()
+		} else if buff[12]>>4 != 0x2 {
+			return nil, ErrInvalidProxyHeader
+		}
+
+		size := 16 + int(binary.BigEndian.Uint16(buff[14:]))
+		if buff, err = readAtLeast(conn, buff, size); err != nil {
+			return nil, err
+		}
+		pc.pending = buff[size:]
+		if err = parseProxyV2(pc, buff[12]&0xF, buff[13], buff[16:size]); err != nil {
+			return nil, err
+		}
+		return pc, nil
+	default:
+		return noHeader()
+	}
+}
+
+func NewProxyTcpSocket(conn *ProxyConn, packetReceiver ...PacketReceiver) Socket {
+	s := &tcpSocket{}
+	s.init(conn, packetReceiver...)
+	return s
+}
+
+// ListenTCP with PROXY protocol,onNewclient is called after the header is read
+//
+// header is read in a separate goroutine,connection with a bad header is closed
+func ListenTCPWithProxyProtocol(nettype string, service string, option ProxyProtocolOption, onNewclient func(*ProxyConn)) (net.Listener, func(), error) {
+	return ListenTCP(nettype, service, func(conn *net.TCPConn) {
+		go func() {
+			if pc, err := ReadProxyHeader(conn, option); err != nil {
+				conn.Close()
+			} else {
+				onNewclient(pc)
+			}
+		}()
+	})
+}
@@ -0,0 +1,298 @@
+package netgo
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// token bucket limiter of bytes,could be shared by many sockets as a global budget
+//
+// bucket is allowed to go into debt,so a packet larger than burst is never blocked forever,
+// the following traffic waits until the debt is paid back.
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 //bytes per second,no limit if <= 0
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// burst is the max bytes could be sent at once,default bytesPerSecond
+func NewRateLimiter(bytesPerSecond int, burst int) *RateLimiter {
+	l := &RateLimiter{
+		last: time.Now(),
+	}
+	l.SetLimit(bytesPerSecond, burst)
+	l.tokens = l.burst
+	return l
+}
+
+// change limit at runtime,bytesPerSecond <= 0 disables the limiter
+func (l *RateLimiter) SetLimit(bytesPerSecond int, burst int) {
+	if burst <= 0 {
+		burst = bytesPerSecond
+	}
+	l.mu.Lock()
+	l.advance(time.Now())
+	l.rate = float64(bytesPerSecond)
+	l.burst = float64(burst)
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.mu.Unlock()
+}
+
+func (l *RateLimiter) Limit() (bytesPerSecond int, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.rate), int(l.burst)
+}
+
+// call with l.mu locked
+func (l *RateLimiter) advance(now time.Time) {
+	if elapsed := now.Sub(l.last); elapsed > 0 {
+		l.tokens += elapsed.Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+}
+
+// take n tokens,return how long the caller should wait
+func (l *RateLimiter) reserve(n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate <= 0 {
+		return 0
+	}
+	l.advance(time.Now())
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// give back tokens of a cancelled reservation
+func (l *RateLimiter) cancel(n int) {
+	l.mu.Lock()
+	if l.rate > 0 {
+		l.tokens += float64(n)
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.mu.Unlock()
+}
+
+// wait for n tokens,return false if cancel closed before tokens available,tokens are given back then
+func (l *RateLimiter) wait(n int, cancel <-chan struct{}) bool {
+	d := l.reserve(n)
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-cancel:
+		l.cancel(n)
+		return false
+	}
+}
+
+// wait until n bytes are allowed
+func (l *RateLimiter) Wait(ctx context.Context, n int) error {
+	if !l.wait(n, ctx.Done()) {
+		return ctx.Err()
+	}
+	return nil
+}
+
+// wait for n tokens before deadline,tokens are given back if deadline reached or cancel closed first
+func (l *RateLimiter) waitDeadline(n int, deadline time.Time, cancel <-chan struct{}) error {
+	d := l.reserve(n)
+	if d <= 0 {
+		return nil
+	}
+
+	timeout := false
+	if !deadline.IsZero() {
+		if remain := time.Until(deadline); remain < d {
+			d = remain
+			timeout = true
+		}
+	}
+
+	if d > 0 {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-cancel:
+			l.cancel(n)
+			return ErrSocketClosed
+		}
+	}
+
+	if timeout {
+		l.cancel(n)
+		return os.ErrDeadlineExceeded
+	}
+	return nil
+}
+
+type rateLimitedSocket struct {
+	Socket
+	sendLimiter *RateLimiter
+	recvLimiter *RateLimiter
+	die         chan struct{}
+	closeOnce   sync.Once
+}
+
+// wrap socket with limiters,nil limiter means no limit
+//
+// Send and SendBuffers wait for tokens before writing,return os.ErrDeadlineExceeded if deadline reached while waiting.
+// Recv charges tokens after read,the next Recv waits until the debt is paid back.
+// waiting is interrupted by Close with ErrSocketClosed.
+func NewRateLimitedSocket(socket Socket, sendLimiter *RateLimiter, recvLimiter *RateLimiter) Socket {
+	return &rateLimitedSocket{
+		Socket:      socket,
+		sendLimiter: sendLimiter,
+		recvLimiter: recvLimiter,
+		die:         make(chan struct{}),
+	}
+}
+
+func getDeadline(deadline []time.Time) time.Time {
+	if len(deadline) > 0 {
+		return deadline[0]
+	}
+	return time.Time{}
+}
+
+func (rs *rateLimitedSocket) Send(data []byte, deadline ...time.Time) (int, error) {
+	if rs.sendLimiter != nil {
+		if err := rs.sendLimiter.waitDeadline(len(data), getDeadline(deadline), rs.die); err != nil {
+			return 0, err
+		}
+	}
+	return rs.Socket.Send(data, deadline...)
+}
+
+func (rs *rateLimitedSocket) SendBuffers(buffs net.Buffers, deadline ...time.Time) (int64, error) {
+	sender, ok := rs.Socket.(BuffersSender)
+	if !ok {
+		outputBuffer := make([]byte, 0, buffsSize(buffs))
+		for _, v := range buffs {
+			outputBuffer = append(outputBuffer, v...)
+		}
+		n, err := rs.Send(outputBuffer, deadline...)
+		return int64(n), err
+	}
+	if rs.sendLimiter != nil {
+		if err := rs.sendLimiter.waitDeadline(buffsSize(buffs), getDeadline(deadline), rs.die); err != nil {
+			return 0, err
+		}
+	}
+	return sender.SendBuffers(buffs, deadline...)
+}
+
+func (rs *rateLimitedSocket) Recv(deadline ...time.Time) ([]byte, error) {
+	if rs.recvLimiter != nil {
+		//pay back the debt of the last read
+		if err := rs.recvLimiter.waitDeadline(0, getDeadline(deadline), rs.die); err != nil {
+			return nil, err
+		}
+	}
+	packet, err := rs.Socket.Recv(deadline...)
+	if rs.recvLimiter != nil && len(packet) > 0 {
+		rs.recvLimiter.reserve(len(packet))
+	}
+	return packet, err
+}
+
+// reader of RecvStream,bytes read are charged to the recv limiter
+type rateLimitedReader struct {
+	io.Reader
+	rs       *rateLimitedSocket
+	deadline time.Time
+}
+
+func (r *rateLimitedReader) Read(b []byte) (int, error) {
+	//pay back the debt of the last read
+	if err := r.rs.recvLimiter.waitDeadline(0, r.deadline, r.rs.die); err != nil {
+		return 0, err
+	}
+	n, err := r.Reader.Read(b)
+	if n > 0 {
+		r.rs.recvLimiter.reserve(n)
+	}
+	return n, err
+}
+
+// discard the rest of the packet,discarded bytes are charged too
+func (r *rateLimitedReader) Close() error {
+	_, err := io.Copy(io.Discard, r)
+	return err
+}
+
+// bytes read by handler and discarded after handler returned are charged to the recv limiter
+func (rs *rateLimitedSocket) RecvStream(handler func(io.Reader) error, deadline ...time.Time) error {
+	receiver, ok := rs.Socket.(StreamReceiver)
+	if !ok {
+		return ErrStreamRecvNotSupported
+	}
+	if rs.recvLimiter == nil {
+		return receiver.RecvStream(handler, deadline...)
+	}
+	if err := rs.recvLimiter.waitDeadline(0, getDeadline(deadline), rs.die); err != nil {
+		return err
+	}
+	return receiver.RecvStream(func(reader io.Reader) error {
+		r := &rateLimitedReader{Reader: reader, rs: rs, deadline: getDeadline(deadline)}
+		if err := handler(r); err != nil {
+			return err
+		}
+		return r.Close()
+	}, deadline...)
+}
+
+func (rs *rateLimitedSocket) Close() {
+	rs.closeOnce.Do(func() {
+		close(rs.die)
+	})
+	rs.Socket.Close()
+}
+
+func (rs *rateLimitedSocket) ReleasePacket(packet []byte) {
+	if releaser, ok := rs.Socket.(PacketReleaser); ok {
+		releaser.ReleasePacket(packet)
+	}
+}
+
+func (rs *rateLimitedSocket) CanCloseWrite() bool {
+	cw, ok := rs.Socket.(CloseWriter)
+	return ok && cw.CanCloseWrite()
+}
+
+func (rs *rateLimitedSocket) CloseWrite() error {
+	if cw, ok := rs.Socket.(CloseWriter); ok {
+		return cw.CloseWrite()
+	}
+	return ErrCloseWriteNotSupported
+}
+
+func buffsSize(buffs net.Buffers) int {
+	n := 0
+	for _, v := range buffs {
+		n += len(v)
+	}
+	return n
+}
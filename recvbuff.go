@@ -0,0 +1,60 @@
+package netgo
+
+import (
+	"time"
+)
+
+const defaultRecvBuffSize int = 4096
+
+// reusable read buffer of the framing PacketReceivers
+//
+// data in buff[r:w] is received but not yet consumed
+type recvBuff struct {
+	buff []byte
+	r    int
+	w    int
+}
+
+func (rb *recvBuff) buffered() []byte {
+	return rb.buff[rb.r:rb.w]
+}
+
+func (rb *recvBuff) skip(n int) {
+	rb.r += n
+	if rb.r == rb.w {
+		rb.r = 0
+		rb.w = 0
+	}
+}
+
+// read once from readable,make sure there is room for at least size bytes start from r
+func (rb *recvBuff) fill(readable ReadAble, deadline time.Time, size int) error {
+	if size < defaultRecvBuffSize {
+		size = defaultRecvBuffSize
+	}
+
+	if size > len(rb.buff) {
+		buff := make([]byte, size)
+		copy(buff, rb.buff[rb.r:rb.w])
+		rb.w = rb.w - rb.r
+		rb.r = 0
+		rb.buff = buff
+	} else if rb.r > 0 && (len(rb.buff)-rb.r < size || rb.w == len(rb.buff)) {
+		//移动到头部
+		copy(rb.buff, rb.buff[rb.r:rb.w])
+		rb.w = rb.w - rb.r
+		rb.r = 0
+	}
+
+	if err := readable.SetReadDeadline(deadline); err != nil {
+		return err
+	}
+
+	n, err := readable.Read(rb.buff[rb.w:])
+	if n > 0 {
+		//process received data first,err would be returned again by the next read
+		rb.w += n
+		return nil
+	}
+	return err
+}
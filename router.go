@@ -0,0 +1,105 @@
+package netgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+var (
+	ErrUnhandledMessage error = errors.New("unhandledMessage")
+)
+
+type PacketHandler func(context.Context, *AsynSocket, interface{}) error
+
+// dispatch decoded messages to handlers by message Go type or message id
+//
+//	router := NewRouter()
+//	Handle(router, func(ctx context.Context, s *AsynSocket, msg *pb.Echo) error {...})
+//	NewAsynSocket(socket, option).SetPacketHandler(router.Dispatch).Recv()
+//
+// handler error closes the socket with the error as reason.
+type Router struct {
+	sync.RWMutex
+	byType    map[reflect.Type]PacketHandler
+	byID      map[uint32]PacketHandler
+	messageID func(interface{}) (uint32, bool)
+	fallback  PacketHandler
+}
+
+func NewRouter() *Router {
+	return &Router{
+		byType: map[reflect.Type]PacketHandler{},
+		byID:   map[uint32]PacketHandler{},
+		fallback: func(context.Context, *AsynSocket, interface{}) error {
+			return ErrUnhandledMessage
+		},
+	}
+}
+
+// messageID resolves id of message for handlers registered by RegisterID,e.g. ProtoRegistry.MessageID
+func (r *Router) SetMessageIDResolver(messageID func(interface{}) (uint32, bool)) *Router {
+	r.Lock()
+	r.messageID = messageID
+	r.Unlock()
+	return r
+}
+
+// fallback is called for message without handler,default returns ErrUnhandledMessage
+func (r *Router) SetFallback(fallback PacketHandler) *Router {
+	if fallback != nil {
+		r.Lock()
+		r.fallback = fallback
+		r.Unlock()
+	}
+	return r
+}
+
+// register handler for message with the same Go type as msg
+func (r *Router) Register(msg interface{}, handler PacketHandler) *Router {
+	r.Lock()
+	r.byType[reflect.TypeOf(msg)] = handler
+	r.Unlock()
+	return r
+}
+
+func (r *Router) RegisterID(id uint32, handler PacketHandler) *Router {
+	r.Lock()
+	r.byID[id] = handler
+	r.Unlock()
+	return r
+}
+
+// register a typed handler,T is the concrete type of the message,e.g. *pb.Echo
+//
+// messages are dispatched by concrete type,panic if T is an interface type.
+func Handle[T any](r *Router, handler func(context.Context, *AsynSocket, T) error) *Router {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() == reflect.Interface {
+		panic(fmt.Sprintf("netgo: Handle with interface type %v", t))
+	}
+	r.Lock()
+	r.byType[t] = func(ctx context.Context, s *AsynSocket, msg interface{}) error {
+		return handler(ctx, s, msg.(T))
+	}
+	r.Unlock()
+	return r
+}
+
+// packet handler for AsynSocket.SetPacketHandler
+func (r *Router) Dispatch(ctx context.Context, s *AsynSocket, msg interface{}) error {
+	r.RLock()
+	handler, ok := r.byType[reflect.TypeOf(msg)]
+	if !ok && r.messageID != nil {
+		if id, ok := r.messageID(msg); ok {
+			handler = r.byID[id]
+		}
+	}
+	if handler == nil {
+		handler = r.fallback
+	}
+	r.RUnlock()
+	return handler(ctx, s, msg)
+}
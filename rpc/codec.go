@@ -0,0 +1,94 @@
+package rpc
+
+import (
+	"encoding/binary"
+	"net"
+
+	"github.com/sniperHW/netgo"
+)
+
+const (
+	kindRequest  byte = 1
+	kindNotify   byte = 2
+	kindResponse byte = 3
+	//stream messages,seq is the stream id
+	kindStreamOpen   byte = 4
+	kindStreamData   byte = 5
+	kindStreamClose  byte = 6
+	kindStreamReset  byte = 7
+	kindStreamCredit byte = 8
+)
+
+// rpc message on the wire:[len:4][kind:1][seq:8][methodLen:2][method][errLen:2][err][payload]
+type message struct {
+	kind    byte
+	seq     uint64
+	method  string
+	err     string
+	payload []byte
+}
+
+// ObjCodec and PacketReceiver of rpc messages,one codec per socket
+//
+//	codec := rpc.NewCodec(0)
+//	socket := netgo.NewAsynSocket(netgo.NewTcpSocket(conn, codec), netgo.AsynSocketOption{Codec: codec})
+type Codec struct {
+	*netgo.LengthPrefixReceiver
+}
+
+// maxPacketSize <= 0 means 65535
+func NewCodec(maxPacketSize int) *Codec {
+	return &Codec{
+		LengthPrefixReceiver: netgo.NewLengthPrefixReceiver(netgo.LengthPrefixOption{MaxPacketSize: maxPacketSize}),
+	}
+}
+
+func (codec *Codec) Encode(buffs net.Buffers, o interface{}) (net.Buffers, int) {
+	m, ok := o.(*message)
+	if !ok {
+		return buffs, 0
+	}
+	header := make([]byte, 13+len(m.method)+len(m.err))
+	header[0] = m.kind
+	binary.BigEndian.PutUint64(header[1:], m.seq)
+	binary.BigEndian.PutUint16(header[9:], uint16(len(m.method)))
+	copy(header[11:], m.method)
+	binary.BigEndian.PutUint16(header[11+len(m.method):], uint16(len(m.err)))
+	copy(header[13+len(m.method):], m.err)
+	size := len(header) + len(m.payload)
+	buffs, n := codec.AppendHeader(buffs, size)
+	if n == 0 {
+		//too large,drop rather than write a corrupt frame
+		return buffs, 0
+	}
+	buffs = append(buffs, header)
+	if len(m.payload) > 0 {
+		buffs = append(buffs, m.payload)
+	}
+	return buffs, n + size
+}
+
+func (codec *Codec) Decode(b []byte) (interface{}, error) {
+	if len(b) < 11 {
+		return nil, netgo.ErrInvalidPacketLength
+	}
+	m := &message{
+		kind: b[0],
+		seq:  binary.BigEndian.Uint64(b[1:]),
+	}
+	l := int(binary.BigEndian.Uint16(b[9:]))
+	b = b[11:]
+	if len(b) < l+2 {
+		return nil, netgo.ErrInvalidPacketLength
+	}
+	m.method = string(b[:l])
+	b = b[l:]
+	l = int(binary.BigEndian.Uint16(b))
+	b = b[2:]
+	if len(b) < l {
+		return nil, netgo.ErrInvalidPacketLength
+	}
+	m.err = string(b[:l])
+	m.payload = append([]byte{}, b[l:]...)
+	return m, nil
+}
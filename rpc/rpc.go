@@ -0,0 +1,355 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/sniperHW/netgo"
+)
+
+var (
+	ErrNotBytes       error = errors.New("rpc: payload is not []byte")
+	ErrReplied        error = errors.New("rpc: already replied")
+	ErrUnknownMessage error = errors.New("rpc: unknown message")
+)
+
+// error returned by the remote peer
+type Error struct {
+	Desc string
+}
+
+func (e *Error) Error() string {
+	return e.Desc
+}
+
+// serialize arguments and replies,ProtoRegistry is a Serializer of protobuf messages
+type Serializer interface {
+	Marshal(interface{}) ([]byte, error)
+	Unmarshal([]byte) (interface{}, error)
+}
+
+// default Serializer,payload is []byte
+type bytesSerializer struct {
+}
+
+func (bytesSerializer) Marshal(o interface{}) ([]byte, error) {
+	if o == nil {
+		return nil, nil
+	} else if b, ok := o.([]byte); ok {
+		return b, nil
+	} else {
+		return nil, ErrNotBytes
+	}
+}
+
+func (bytesSerializer) Unmarshal(b []byte) (interface{}, error) {
+	return b, nil
+}
+
+// handler of a method,reply is sent by Replyer.Reply,the reply could be sent after handler returned
+type Method func(context.Context, *Replyer, interface{})
+
+// registered methods,could be shared by many Conn
+type Server struct {
+	sync.RWMutex
+	methods map[string]Method
+	streams map[string]StreamMethod
+}
+
+func NewServer() *Server {
+	return &Server{
+		methods: map[string]Method{},
+		streams: map[string]StreamMethod{},
+	}
+}
+
+func (s *Server) Register(name string, method Method) *Server {
+	s.Lock()
+	s.methods[name] = method
+	s.Unlock()
+	return s
+}
+
+func (s *Server) getMethod(name string) Method {
+	s.RLock()
+	defer s.RUnlock()
+	return s.methods[name]
+}
+
+type Replyer struct {
+	conn    *Conn
+	seq     uint64
+	oneway  bool
+	replied int32
+}
+
+func (r *Replyer) Conn() *Conn {
+	return r.conn
+}
+
+// send reply to the caller,nothing is sent for a notification
+func (r *Replyer) Reply(ret interface{}, err error) error {
+	if r.oneway {
+		return nil
+	} else if !atomic.CompareAndSwapInt32(&r.replied, 0, 1) {
+		return ErrReplied
+	}
+
+	m := &message{
+		kind: kindResponse,
+		seq:  r.seq,
+	}
+
+	if err == nil {
+		m.payload, err = r.conn.serializer.Marshal(ret)
+	}
+
+	if err != nil {
+		if m.err = err.Error(); m.err == "" {
+			m.err = "unknown error"
+		}
+		m.payload = nil
+	}
+
+	return r.conn.socket.Send(m)
+}
+
+// an active call
+type Call struct {
+	Method string
+	Arg    interface{}
+	Reply  interface{}
+	Error  error
+	Done   chan *Call
+	seq    uint64
+}
+
+func (call *Call) done() {
+	select {
+	case call.Done <- call:
+	default:
+	}
+}
+
+type Option struct {
+	Server       *Server            //methods served by the Conn,nil if the Conn is a pure client
+	Serializer   Serializer         //default serializer for []byte
+	OnClose      func(*Conn, error) //called after socket closed,pending calls and streams are failed before it
+	StreamWindow int                //max messages buffered by a receiving stream,default DefaultStreamWindow
+	MaxStreams   int                //max concurrent streams opened by the peer,stream exceeds it is reset,default DefaultMaxStreams
+}
+
+// request/response rpc on a AsynSocket,both sides of a Conn could call and serve
+type Conn struct {
+	socket        *netgo.AsynSocket
+	server        *Server
+	serializer    Serializer
+	onClose       func(*Conn, error)
+	streamWindow  int
+	maxStreams    int
+	mu            sync.Mutex
+	nextSeq       uint64
+	pending       map[uint64]*Call
+	nextStreamID  uint64
+	streams       map[uint64]*Stream //opened by this side
+	remoteStreams map[uint64]*Stream //opened by the peer
+	closeErr      error
+}
+
+// socket should be created with Codec,NewConn takes over packet handler and close callback of socket and starts receiving
+func NewConn(socket *netgo.AsynSocket, option Option) *Conn {
+	c := &Conn{
+		socket:        socket,
+		server:        option.Server,
+		serializer:    option.Serializer,
+		onClose:       option.OnClose,
+		streamWindow:  option.StreamWindow,
+		maxStreams:    option.MaxStreams,
+		pending:       map[uint64]*Call{},
+		streams:       map[uint64]*Stream{},
+		remoteStreams: map[uint64]*Stream{},
+	}
+
+	if c.serializer == nil {
+		c.serializer = bytesSerializer{}
+	}
+
+	if c.streamWindow <= 0 {
+		c.streamWindow = DefaultStreamWindow
+	}
+
+	if c.maxStreams <= 0 {
+		c.maxStreams = DefaultMaxStreams
+	}
+
+	socket.SetPacketHandler(c.onPacket).SetCloseCallback(c.onSocketClose).Recv()
+
+	return c
+}
+
+func (c *Conn) GetAsynSocket() *netgo.AsynSocket {
+	return c.socket
+}
+
+func (c *Conn) Close(err error) {
+	c.socket.Close(err)
+}
+
+func (c *Conn) onSocketClose(_ *netgo.AsynSocket, err error) {
+	if err == nil {
+		err = netgo.ErrSocketClosed
+	}
+	c.mu.Lock()
+	c.closeErr = err
+	pending := c.pending
+	c.pending = map[uint64]*Call{}
+	c.mu.Unlock()
+
+	for _, call := range pending {
+		call.Error = err
+		call.done()
+	}
+
+	c.closeStreams(err)
+
+	if c.onClose != nil {
+		c.onClose(c, err)
+	}
+}
+
+func (c *Conn) onPacket(ctx context.Context, s *netgo.AsynSocket, packet interface{}) error {
+	m, ok := packet.(*message)
+	if !ok {
+		return ErrUnknownMessage
+	}
+	switch m.kind {
+	case kindRequest, kindNotify:
+		c.serve(ctx, m)
+	case kindResponse:
+		c.onResponse(m)
+	case kindStreamOpen, kindStreamData, kindStreamClose, kindStreamReset, kindStreamCredit:
+		c.onStreamMessage(ctx, m)
+	default:
+		return ErrUnknownMessage
+	}
+	s.Recv()
+	return nil
+}
+
+func (c *Conn) serve(ctx context.Context, m *message) {
+	replyer := &Replyer{
+		conn:   c,
+		seq:    m.seq,
+		oneway: m.kind == kindNotify,
+	}
+
+	var method Method
+	if c.server != nil {
+		method = c.server.getMethod(m.method)
+	}
+
+	if method == nil {
+		replyer.Reply(nil, &Error{Desc: "method not found:" + m.method})
+	} else if arg, err := c.serializer.Unmarshal(m.payload); err != nil {
+		replyer.Reply(nil, err)
+	} else {
+		method(ctx, replyer, arg)
+	}
+}
+
+func (c *Conn) removePending(seq uint64) *Call {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	call := c.pending[seq]
+	delete(c.pending, seq)
+	return call
+}
+
+func (c *Conn) onResponse(m *message) {
+	if call := c.removePending(m.seq); call != nil {
+		if m.err != "" {
+			call.Error = &Error{Desc: m.err}
+		} else {
+			call.Reply, call.Error = c.serializer.Unmarshal(m.payload)
+		}
+		call.done()
+	}
+}
+
+// asynchronize call,call is sent to done when completed
+//
+// ctx is used while pushing the request to the send queue,done must be buffered,a new channel is made if done is nil
+func (c *Conn) Go(ctx context.Context, method string, arg interface{}, done chan *Call) *Call {
+	if done == nil {
+		done = make(chan *Call, 1)
+	} else if cap(done) == 0 {
+		panic("rpc: done channel is unbuffered")
+	}
+
+	call := &Call{
+		Method: method,
+		Arg:    arg,
+		Done:   done,
+	}
+
+	payload, err := c.serializer.Marshal(arg)
+	if err != nil {
+		call.Error = err
+		call.done()
+		return call
+	}
+
+	c.mu.Lock()
+	if c.closeErr != nil {
+		c.mu.Unlock()
+		call.Error = c.closeErr
+		call.done()
+		return call
+	}
+	c.nextSeq++
+	call.seq = c.nextSeq
+	c.pending[call.seq] = call
+	c.mu.Unlock()
+
+	if err = c.socket.SendWithContext(ctx, &message{
+		kind:    kindRequest,
+		seq:     call.seq,
+		method:  method,
+		payload: payload,
+	}); err != nil {
+		if c.removePending(call.seq) != nil {
+			call.Error = err
+			call.done()
+		}
+	}
+	return call
+}
+
+// call method and wait for the reply,call is cancelled when ctx is done
+func (c *Conn) Call(ctx context.Context, method string, arg interface{}) (interface{}, error) {
+	call := c.Go(ctx, method, arg, make(chan *Call, 1))
+	select {
+	case <-call.Done:
+	case <-ctx.Done():
+		if c.removePending(call.seq) != nil {
+			return nil, ctx.Err()
+		}
+		<-call.Done
+	}
+	return call.Reply, call.Error
+}
+
+// one-way notification,no reply
+func (c *Conn) Notify(ctx context.Context, method string, arg interface{}) error {
+	payload, err := c.serializer.Marshal(arg)
+	if err != nil {
+		return err
+	}
+	return c.socket.SendWithContext(ctx, &message{
+		kind:    kindNotify,
+		method:  method,
+		payload: payload,
+	})
+}
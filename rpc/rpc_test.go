@@ -0,0 +1,217 @@
+package rpc
+
+//go test -race -covermode=atomic -v -coverprofile=coverage.out -run=.
+//go tool cover -html=coverage.out
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/sniperHW/netgo"
+)
+
+func newConn(conn *net.TCPConn, option Option) *Conn {
+	codec := NewCodec(0)
+	return NewConn(netgo.NewAsynSocket(netgo.NewTcpSocket(conn, codec), netgo.AsynSocketOption{
+		Codec: codec,
+	}), option)
+}
+
+func TestRPC(t *testing.T) {
+	notifyChan := make(chan string, 1)
+	server := NewServer()
+	server.Register("echo", func(_ context.Context, replyer *Replyer, arg interface{}) {
+		replyer.Reply(arg, nil)
+	}).Register("fail", func(_ context.Context, replyer *Replyer, arg interface{}) {
+		replyer.Reply(nil, errors.New("failed"))
+	}).Register("notify", func(_ context.Context, replyer *Replyer, arg interface{}) {
+		notifyChan <- string(arg.([]byte))
+	}).Register("noreply", func(_ context.Context, replyer *Replyer, arg interface{}) {
+	})
+
+	listener, serve, _ := netgo.ListenTCP("tcp", "localhost:18110", func(conn *net.TCPConn) {
+		newConn(conn, Option{Server: server})
+	})
+	go serve()
+
+	dialer := &net.Dialer{}
+	conn, _ := dialer.Dial("tcp", "localhost:18110")
+	closeChan := make(chan error, 1)
+	c := newConn(conn.(*net.TCPConn), Option{
+		OnClose: func(_ *Conn, err error) {
+			closeChan <- err
+		},
+	})
+
+	if reply, err := c.Call(context.Background(), "echo", []byte("hello")); err != nil || string(reply.([]byte)) != "hello" {
+		t.Fatal(reply, err)
+	}
+
+	var rpcErr *Error
+	if _, err := c.Call(context.Background(), "fail", nil); !errors.As(err, &rpcErr) || rpcErr.Desc != "failed" {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Call(context.Background(), "missing", nil); !errors.As(err, &rpcErr) {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Call(context.Background(), "echo", "not bytes"); err != ErrNotBytes {
+		t.Fatal(err)
+	}
+
+	c.Notify(context.Background(), "notify", []byte("hello"))
+	if msg := <-notifyChan; msg != "hello" {
+		t.Fatal(msg)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	if _, err := c.Call(ctx, "noreply", nil); err != context.DeadlineExceeded {
+		t.Fatal(err)
+	}
+	cancel()
+
+	//pending call fails with close reason
+	call := c.Go(context.Background(), "noreply", nil, nil)
+	closeReason := errors.New("close")
+	c.Close(closeReason)
+	<-call.Done
+	if call.Error != closeReason {
+		t.Fatal(call.Error)
+	}
+	if err := <-closeChan; err != closeReason {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Call(context.Background(), "echo", nil); err != closeReason {
+		t.Fatal(err)
+	}
+
+	listener.Close()
+}
+
+func TestStream(t *testing.T) {
+	server := NewServer()
+	//server streaming:reply each request message twice,then finish
+	server.RegisterStream("echo", func(ctx context.Context, s *Stream) {
+		for {
+			msg, err := s.Recv(ctx)
+			if err != nil {
+				return
+			}
+			s.Send(ctx, msg)
+			s.Send(ctx, msg)
+		}
+	})
+	//never receive,sender is blocked by flow control
+	blockChan := make(chan struct{})
+	server.RegisterStream("block", func(ctx context.Context, s *Stream) {
+		select {
+		case <-blockChan:
+		case <-ctx.Done():
+		}
+	})
+
+	listener, serve, _ := netgo.ListenTCP("tcp", "localhost:18110", func(conn *net.TCPConn) {
+		newConn(conn, Option{Server: server, StreamWindow: 4, MaxStreams: 2})
+	})
+	go serve()
+
+	dialer := &net.Dialer{}
+	conn, _ := dialer.Dial("tcp", "localhost:18110")
+	c := newConn(conn.(*net.TCPConn), Option{StreamWindow: 4})
+
+	blocked, err := c.OpenStream(context.Background(), "block")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 4; i++ {
+		if err := blocked.Send(context.Background(), []byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	if err := blocked.Send(ctx, []byte("hello")); err != context.DeadlineExceeded {
+		t.Fatal(err)
+	}
+	cancel()
+
+	//CloseSend isn't blocked by Send waiting for credit
+	sendErr := make(chan error, 1)
+	go func() {
+		sendErr <- blocked.Send(context.Background(), []byte("hello"))
+	}()
+	time.Sleep(time.Millisecond * 50)
+	closeDone := make(chan struct{})
+	go func() {
+		blocked.CloseSend()
+		close(closeDone)
+	}()
+	select {
+	case <-closeDone:
+	case <-time.After(time.Second):
+		t.Fatal("CloseSend blocked")
+	}
+	if err := <-sendErr; err != ErrStreamClosed {
+		t.Fatal(err)
+	}
+
+	//the blocked stream doesn't affect other streams
+	s, err := c.OpenStream(context.Background(), "echo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for i := 0; i < 100; i++ {
+			s.Send(context.Background(), []byte{byte(i)})
+		}
+		s.CloseSend()
+	}()
+	for i := 0; i < 200; i++ {
+		msg, err := s.Recv(context.Background())
+		if err != nil || msg.([]byte)[0] != byte(i/2) {
+			t.Fatal(i, msg, err)
+		}
+	}
+	if _, err := s.Recv(context.Background()); err != io.EOF {
+		t.Fatal(err)
+	}
+
+	//cancel the blocked stream
+	blocked.Cancel()
+	if err := blocked.Send(context.Background(), []byte("hello")); err != ErrStreamCancelled {
+		t.Fatal(err)
+	}
+
+	//unknown method
+	s, _ = c.OpenStream(context.Background(), "missing")
+	var rpcErr *Error
+	if _, err := s.Recv(context.Background()); !errors.As(err, &rpcErr) {
+		t.Fatal(err)
+	}
+
+	//streams exceed MaxStreams are reset
+	b1, _ := c.OpenStream(context.Background(), "block")
+	b2, _ := c.OpenStream(context.Background(), "block")
+	s, _ = c.OpenStream(context.Background(), "block")
+	if _, err := s.Recv(context.Background()); !errors.As(err, &rpcErr) || rpcErr.Desc != ErrTooManyStreams.Error() {
+		t.Fatal(err)
+	}
+	b1.Cancel()
+	b2.Cancel()
+
+	//streams fail when conn closed
+	s, _ = c.OpenStream(context.Background(), "block")
+	closeReason := errors.New("close")
+	c.Close(closeReason)
+	if _, err := s.Recv(context.Background()); err != closeReason {
+		t.Fatal(err)
+	}
+
+	close(blockChan)
+	listener.Close()
+}
@@ -0,0 +1,425 @@
+package rpc
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+)
+
+var (
+	ErrStreamClosed    error = errors.New("rpc: stream send closed")
+	ErrStreamCancelled error = errors.New("rpc: stream cancelled")
+	ErrTooManyStreams  error = errors.New("rpc: too many streams")
+)
+
+// set in id of stream messages sent on a stream opened by the peer
+const streamRemote uint64 = 1 << 63
+
+// default number of messages a stream could receive without granting more credits
+const DefaultStreamWindow int = 64
+
+// default max concurrent streams opened by the peer on a Conn
+const DefaultMaxStreams int = 1024
+
+// handler of a stream method,runs in its own goroutine,the stream is finished when handler returned
+type StreamMethod func(context.Context, *Stream)
+
+func (s *Server) RegisterStream(name string, method StreamMethod) *Server {
+	s.Lock()
+	s.streams[name] = method
+	s.Unlock()
+	return s
+}
+
+func (s *Server) getStreamMethod(name string) StreamMethod {
+	s.RLock()
+	defer s.RUnlock()
+	return s.streams[name]
+}
+
+func putCredit(n int) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(n))
+	return b
+}
+
+func getCredit(b []byte) int {
+	if len(b) < 4 {
+		return 0
+	}
+	return int(binary.BigEndian.Uint32(b))
+}
+
+// a logical bidirectional stream on a Conn
+//
+// messages are delivered in order,each side could only send when the peer granted credits,
+// so a slow stream doesn't occupy the send queue of the socket shared by other streams.
+type Stream struct {
+	conn      *Conn
+	id        uint64
+	remote    bool //opened by the peer
+	method    string
+	ctx       context.Context
+	cancel    context.CancelFunc
+	sendMu    sync.Mutex
+	mu        sync.Mutex
+	changed   chan struct{} //closed and replaced on every state change
+	queue     []interface{}
+	window    int
+	consumed  int
+	credit    int
+	sendEOF   bool //CloseSend called
+	remoteEOF bool //peer called CloseSend
+	err       error
+	finished  bool
+}
+
+func newStream(c *Conn, ctx context.Context, id uint64, remote bool, method string) *Stream {
+	s := &Stream{
+		conn:    c,
+		id:      id,
+		remote:  remote,
+		method:  method,
+		changed: make(chan struct{}),
+		window:  c.streamWindow,
+	}
+	s.ctx, s.cancel = context.WithCancel(ctx)
+	return s
+}
+
+func (s *Stream) Method() string {
+	return s.method
+}
+
+// done when the stream finished or cancelled
+func (s *Stream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *Stream) wireID() uint64 {
+	if s.remote {
+		return s.id | streamRemote
+	}
+	return s.id
+}
+
+// call with s.mu locked
+func (s *Stream) notifyLocked() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// call with s.mu locked,remove from conn when both directions finished
+func (s *Stream) checkFinishLocked() {
+	if !s.finished && (s.err != nil || (s.sendEOF && s.remoteEOF)) {
+		s.finished = true
+		s.conn.removeStream(s)
+		s.cancel()
+	}
+}
+
+// wait for state change,return false if ctx is done
+func (s *Stream) waitLocked(ctx context.Context) error {
+	ch := s.changed
+	s.mu.Unlock()
+	defer s.mu.Lock()
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Stream) Send(ctx context.Context, msg interface{}) error {
+	payload, err := s.conn.serializer.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+
+	s.mu.Lock()
+	for s.credit == 0 && s.err == nil && !s.sendEOF {
+		if err = s.waitLocked(ctx); err != nil {
+			s.mu.Unlock()
+			return err
+		}
+	}
+	if s.err != nil {
+		err = s.err
+	} else if s.sendEOF {
+		err = ErrStreamClosed
+	} else {
+		s.credit--
+	}
+	s.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	return s.conn.socket.SendWithContext(ctx, &message{
+		kind:    kindStreamData,
+		seq:     s.wireID(),
+		payload: payload,
+	})
+}
+
+// return io.EOF after the peer called CloseSend and all messages are received
+func (s *Stream) Recv(ctx context.Context) (interface{}, error) {
+	s.mu.Lock()
+	for len(s.queue) == 0 && !s.remoteEOF && s.err == nil {
+		if err := s.waitLocked(ctx); err != nil {
+			s.mu.Unlock()
+			return nil, err
+		}
+	}
+
+	if len(s.queue) == 0 {
+		defer s.mu.Unlock()
+		if s.remoteEOF {
+			return nil, io.EOF
+		} else {
+			return nil, s.err
+		}
+	}
+
+	msg := s.queue[0]
+	s.queue[0] = nil
+	s.queue = s.queue[1:]
+	s.consumed++
+	grant := 0
+	if s.consumed >= (s.window+1)/2 && !s.remoteEOF && s.err == nil {
+		grant = s.consumed
+		s.consumed = 0
+	}
+	s.mu.Unlock()
+
+	if grant > 0 {
+		s.conn.socket.Send(&message{
+			kind:    kindStreamCredit,
+			seq:     s.wireID(),
+			payload: putCredit(grant),
+		})
+	}
+
+	return msg, nil
+}
+
+// half close,the peer receives io.EOF after all sent messages
+func (s *Stream) CloseSend() error {
+	s.mu.Lock()
+	if s.err != nil || s.sendEOF {
+		s.mu.Unlock()
+		return nil
+	}
+	//wake up Send waiting for credit
+	s.sendEOF = true
+	s.notifyLocked()
+	s.checkFinishLocked()
+	s.mu.Unlock()
+	//Send holding sendMu has taken credit,its message goes before close
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	return s.conn.socket.Send(&message{
+		kind: kindStreamClose,
+		seq:  s.wireID(),
+	})
+}
+
+// abort the stream,the peer receives the error
+func (s *Stream) Cancel() {
+	s.reset(ErrStreamCancelled, true)
+}
+
+func (s *Stream) reset(err error, sendReset bool) {
+	s.mu.Lock()
+	if s.finished {
+		s.mu.Unlock()
+		return
+	}
+	s.err = err
+	s.notifyLocked()
+	s.checkFinishLocked()
+	s.mu.Unlock()
+	if sendReset {
+		s.conn.socket.Send(&message{
+			kind: kindStreamReset,
+			seq:  s.wireID(),
+			err:  err.Error(),
+		})
+	}
+}
+
+func (s *Stream) onData(msg interface{}) {
+	s.mu.Lock()
+	if s.remoteEOF || s.err != nil {
+		s.mu.Unlock()
+		return
+	} else if len(s.queue) >= s.window {
+		s.mu.Unlock()
+		s.reset(errors.New("rpc: stream flow control violation"), true)
+		return
+	}
+	s.queue = append(s.queue, msg)
+	s.notifyLocked()
+	s.mu.Unlock()
+}
+
+func (s *Stream) onRemoteEOF() {
+	s.mu.Lock()
+	s.remoteEOF = true
+	s.notifyLocked()
+	s.checkFinishLocked()
+	s.mu.Unlock()
+}
+
+func (s *Stream) onCredit(n int) {
+	s.mu.Lock()
+	s.credit += n
+	s.notifyLocked()
+	s.mu.Unlock()
+}
+
+// open a stream to method of the peer,stream is cancelled when ctx is done
+func (c *Conn) OpenStream(ctx context.Context, method string) (*Stream, error) {
+	c.mu.Lock()
+	if c.closeErr != nil {
+		c.mu.Unlock()
+		return nil, c.closeErr
+	}
+	c.nextStreamID++
+	s := newStream(c, ctx, c.nextStreamID, false, method)
+	c.streams[s.id] = s
+	c.mu.Unlock()
+
+	if err := c.socket.SendWithContext(ctx, &message{
+		kind:    kindStreamOpen,
+		seq:     s.id,
+		method:  method,
+		payload: putCredit(s.window),
+	}); err != nil {
+		s.reset(err, false)
+		return nil, err
+	}
+
+	go func() {
+		<-s.ctx.Done()
+		s.Cancel()
+	}()
+
+	return s, nil
+}
+
+func (c *Conn) removeStream(s *Stream) {
+	c.mu.Lock()
+	if s.remote {
+		delete(c.remoteStreams, s.id)
+	} else {
+		delete(c.streams, s.id)
+	}
+	c.mu.Unlock()
+}
+
+func (c *Conn) getStream(wireID uint64) *Stream {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if wireID&streamRemote != 0 {
+		//stream opened by this side
+		return c.streams[wireID&^streamRemote]
+	} else {
+		return c.remoteStreams[wireID]
+	}
+}
+
+func (c *Conn) onStreamOpen(ctx context.Context, m *message) {
+	s := newStream(c, ctx, m.seq, true, m.method)
+	s.credit = getCredit(m.payload)
+
+	var method StreamMethod
+	if c.server != nil {
+		method = c.server.getStreamMethod(m.method)
+	}
+
+	c.mu.Lock()
+	_, exist := c.remoteStreams[s.id]
+	closed := c.closeErr != nil
+	tooMany := len(c.remoteStreams) >= c.maxStreams
+	if !exist && !closed && method != nil && !tooMany {
+		c.remoteStreams[s.id] = s
+	}
+	c.mu.Unlock()
+
+	if exist || closed {
+		return
+	} else if method == nil {
+		s.reset(&Error{Desc: "method not found:" + m.method}, true)
+		return
+	} else if tooMany {
+		s.reset(ErrTooManyStreams, true)
+		return
+	}
+
+	c.socket.Send(&message{
+		kind:    kindStreamCredit,
+		seq:     s.wireID(),
+		payload: putCredit(s.window),
+	})
+
+	go func() {
+		method(s.ctx, s)
+		s.CloseSend()
+		//peer is still sending,tell it the stream is finished
+		s.reset(ErrStreamClosed, true)
+	}()
+}
+
+func (c *Conn) onStreamMessage(ctx context.Context, m *message) error {
+	if m.kind == kindStreamOpen {
+		c.onStreamOpen(ctx, m)
+		return nil
+	}
+
+	s := c.getStream(m.seq)
+	if s == nil {
+		//stream finished
+		return nil
+	}
+
+	switch m.kind {
+	case kindStreamData:
+		if msg, err := c.serializer.Unmarshal(m.payload); err != nil {
+			s.reset(err, true)
+		} else {
+			s.onData(msg)
+		}
+	case kindStreamClose:
+		s.onRemoteEOF()
+	case kindStreamReset:
+		s.reset(&Error{Desc: m.err}, false)
+	case kindStreamCredit:
+		s.onCredit(getCredit(m.payload))
+	}
+	return nil
+}
+
+// fail all streams when conn closed
+func (c *Conn) closeStreams(err error) {
+	c.mu.Lock()
+	streams := make([]*Stream, 0, len(c.streams)+len(c.remoteStreams))
+	for _, v := range c.streams {
+		streams = append(streams, v)
+	}
+	for _, v := range c.remoteStreams {
+		streams = append(streams, v)
+	}
+	c.mu.Unlock()
+
+	for _, v := range streams {
+		v.reset(err, false)
+	}
+}
@@ -0,0 +1,114 @@
+package netgo
+
+import (
+	"context"
+	"time"
+)
+
+// result of SendWithResult,resolved with the error of the write carried the object
+type SendFuture struct {
+	done     chan struct{}
+	err      error
+	callback func(error)
+}
+
+func newSendFuture(callback func(error)) *SendFuture {
+	return &SendFuture{
+		done:     make(chan struct{}),
+		callback: callback,
+	}
+}
+
+func (f *SendFuture) resolve(err error) {
+	f.err = err
+	close(f.done)
+	if f.callback != nil {
+		f.callback(err)
+	}
+}
+
+// closed after resolved
+func (f *SendFuture) Done() <-chan struct{} {
+	return f.done
+}
+
+// result of the send,valid after Done closed
+func (f *SendFuture) Err() error {
+	select {
+	case <-f.done:
+		return f.err
+	default:
+		return nil
+	}
+}
+
+// wait until resolved or ctx done
+func (f *SendFuture) Wait(ctx context.Context) error {
+	select {
+	case <-f.done:
+		return f.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type sendRequest struct {
+	o      interface{}
+	future *SendFuture
+}
+
+// complete object taken from the send queue
+func completeSend(o interface{}, err error) {
+	switch v := o.(type) {
+	case *sendRequest:
+		completeSend(v.o, err)
+		v.future.resolve(err)
+	case *SharedPacket:
+		v.Release()
+	}
+}
+
+// complete objects left in the send queue after sendloop exited
+func (s *AsynSocket) drainSendReq() {
+	for _, ch := range s.sendReq {
+		for len(ch) > 0 {
+			select {
+			case o := <-ch:
+				s.addQueuedBytes(-s.queuedSize(o))
+				completeSend(o, ErrSocketClosed)
+			default:
+			}
+		}
+	}
+}
+
+// same as Send,the returned future is resolved with the result of the write carried o,
+// or ErrSocketClosed if o is still in the send queue when the socket closed.
+//
+// if o failed to push into the send queue,the future is resolved with the error immediately.
+//
+// object dropped by ObjCodec.Encode(encoded to 0 bytes) is resolved with nil,
+// codec should report it by itself,e.g. ProtoCodecOption.OnEncodeError.
+func (s *AsynSocket) SendWithResult(o interface{}, deadline ...time.Time) *SendFuture {
+	return s.sendWithResult(o, nil, deadline)
+}
+
+// same as SendWithResult,callback is called with the result in the send goroutine,
+// or in the calling goroutine if o failed to push into the send queue
+func (s *AsynSocket) SendWithCallback(o interface{}, callback func(error), deadline ...time.Time) {
+	s.sendWithResult(o, callback, deadline)
+}
+
+func (s *AsynSocket) sendWithResult(o interface{}, callback func(error), deadline []time.Time) *SendFuture {
+	req := &sendRequest{
+		o:      o,
+		future: newSendFuture(callback),
+	}
+	if p, ok := o.(*SharedPacket); ok {
+		p.retain()
+	}
+	if err := s.push(req, PriorityNormal, deadline); err != nil {
+		completeSend(req, err)
+	}
+	return req.future
+}
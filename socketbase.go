@@ -1,77 +1,137 @@
-package netgo
-
-import (
-	"net"
-	"sync"
-	"sync/atomic"
-	"time"
-)
-
-// base of kcpSocket/tcpSocket/unixSocket
-type socketBase struct {
-	userData       atomic.Value
-	packetReceiver PacketReceiver
-	conn           net.Conn
-	closeOnce      sync.Once
-}
-
-func (base *socketBase) init(conn net.Conn, packetReceiver ...PacketReceiver) {
-	base.conn = conn
-	if len(packetReceiver) == 0 || packetReceiver[0] == nil {
-		base.packetReceiver = &defaultPacketReceiver{}
-	} else {
-		base.packetReceiver = packetReceiver[0]
-	}
-}
-
-func (base *socketBase) GetUnderConn() interface{} {
-	return base.conn
-}
-
-func (base *socketBase) Close() {
-	base.closeOnce.Do(func() {
-		base.conn.Close()
-	})
-}
-
-func (base *socketBase) LocalAddr() net.Addr {
-	return base.conn.LocalAddr()
-}
-
-func (base *socketBase) RemoteAddr() net.Addr {
-	return base.conn.RemoteAddr()
-}
-
-func (base *socketBase) SetUserData(ud interface{}) {
-	base.userData.Store(userdata{
-		data: ud,
-	})
-}
-
-func (base *socketBase) GetUserData() interface{} {
-	if ud, ok := base.userData.Load().(userdata); ok {
-		return ud.data
-	} else {
-		return nil
-	}
-}
-
-func (base *socketBase) Send(data []byte, deadline ...time.Time) (int, error) {
-	d := time.Time{}
-	if len(deadline) > 0 && !deadline[0].IsZero() {
-		d = deadline[0]
-	}
-	if err := base.conn.SetWriteDeadline(d); err != nil {
-		return 0, err
-	} else {
-		return base.conn.Write(data)
-	}
-}
-
-func (base *socketBase) Recv(deadline ...time.Time) ([]byte, error) {
-	if len(deadline) > 0 && !deadline[0].IsZero() {
-		return base.packetReceiver.Recv(base.conn, deadline[0])
-	} else {
-		return base.packetReceiver.Recv(base.conn, time.Time{})
-	}
-}
+package netgo
+
+import (
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// base of kcpSocket/tcpSocket/unixSocket/stream
+type socketBase struct {
+	userData       atomic.Value
+	packetReceiver PacketReceiver
+	conn           net.Conn
+	reader         countReadAble
+	closeOnce      sync.Once
+	stats          statsCounter
+}
+
+func (base *socketBase) init(conn net.Conn, packetReceiver ...PacketReceiver) {
+	base.conn = conn
+	base.reader = countReadAble{ReadAble: conn, stats: &base.stats}
+	base.stats.init()
+	if len(packetReceiver) == 0 || packetReceiver[0] == nil {
+		base.packetReceiver = &defaultPacketReceiver{}
+	} else {
+		base.packetReceiver = packetReceiver[0]
+	}
+}
+
+func (base *socketBase) GetUnderConn() interface{} {
+	return base.conn
+}
+
+func (base *socketBase) Close() {
+	base.closeOnce.Do(func() {
+		base.conn.Close()
+	})
+}
+
+func (base *socketBase) LocalAddr() net.Addr {
+	return base.conn.LocalAddr()
+}
+
+func (base *socketBase) RemoteAddr() net.Addr {
+	return base.conn.RemoteAddr()
+}
+
+func (base *socketBase) SetUserData(ud interface{}) {
+	base.userData.Store(userdata{
+		data: ud,
+	})
+}
+
+func (base *socketBase) GetUserData() interface{} {
+	if ud, ok := base.userData.Load().(userdata); ok {
+		return ud.data
+	} else {
+		return nil
+	}
+}
+
+func (base *socketBase) Send(data []byte, deadline ...time.Time) (int, error) {
+	d := time.Time{}
+	if len(deadline) > 0 && !deadline[0].IsZero() {
+		d = deadline[0]
+	}
+	if err := base.conn.SetWriteDeadline(d); err != nil {
+		return 0, err
+	} else {
+		n, err := base.conn.Write(data)
+		base.onSend(n, err)
+		return n, err
+	}
+}
+
+func (base *socketBase) onSend(n int, err error) {
+	base.stats.onWrite(n)
+	if err == nil {
+		base.stats.onPacketsSent(1)
+	}
+}
+
+func (base *socketBase) onRecv(packet []byte, err error) {
+	if err == nil {
+		base.stats.onPacketRecv()
+	}
+}
+
+func (base *socketBase) Recv(deadline ...time.Time) (packet []byte, err error) {
+	if len(deadline) > 0 && !deadline[0].IsZero() {
+		packet, err = base.packetReceiver.Recv(base.reader, deadline[0])
+	} else {
+		packet, err = base.packetReceiver.Recv(base.reader, time.Time{})
+	}
+	base.onRecv(packet, err)
+	return packet, err
+}
+
+func (base *socketBase) RecvStream(handler func(io.Reader) error, deadline ...time.Time) error {
+	receiver, ok := base.packetReceiver.(StreamPacketReceiver)
+	if !ok {
+		return ErrStreamRecvNotSupported
+	}
+	d := time.Time{}
+	if len(deadline) > 0 && !deadline[0].IsZero() {
+		d = deadline[0]
+	}
+	return receiver.RecvStream(base.reader, d, func(r io.Reader) error {
+		base.stats.onPacketRecv()
+		return handler(r)
+	})
+}
+
+func (base *socketBase) ReleasePacket(packet []byte) {
+	if releaser, ok := base.packetReceiver.(PacketReleaser); ok {
+		releaser.ReleasePacket(packet)
+	}
+}
+
+type closeWriter interface {
+	CloseWrite() error
+}
+
+func (base *socketBase) CanCloseWrite() bool {
+	_, ok := base.conn.(closeWriter)
+	return ok
+}
+
+func (base *socketBase) CloseWrite() error {
+	if cw, ok := base.conn.(closeWriter); ok {
+		return cw.CloseWrite()
+	} else {
+		return ErrCloseWriteNotSupported
+	}
+}
@@ -0,0 +1,144 @@
+package netgo
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// traffic statistics of Socket and AsynSocket
+type Stats struct {
+	BytesSent     uint64
+	BytesRecv     uint64
+	PacketsSent   uint64 //objects written by AsynSocket,successful Send/SendBuffers calls of Socket
+	PacketsRecv   uint64
+	SendCalls     uint64 //writes to the underlying conn
+	QueuedObjects int    //AsynSocket only
+	QueuedBytes   int    //AsynSocket only
+	LastRead      time.Time
+	LastWrite     time.Time
+	Age           time.Duration
+}
+
+// average objects batched in one write
+func (st Stats) AvgBatchSize() float64 {
+	if st.SendCalls == 0 {
+		return 0
+	}
+	return float64(st.PacketsSent) / float64(st.SendCalls)
+}
+
+// optional interface of Socket,all sockets of this package implement it
+type StatsReporter interface {
+	Stats() Stats
+}
+
+// counters updated by atomic operations
+type statsCounter struct {
+	created     int64 //unix nano
+	bytesSent   uint64
+	bytesRecv   uint64
+	packetsSent uint64
+	packetsRecv uint64
+	sendCalls   uint64
+	lastRead    int64
+	lastWrite   int64
+}
+
+func (c *statsCounter) init() {
+	c.created = time.Now().UnixNano()
+}
+
+// one write to the conn
+func (c *statsCounter) onWrite(n int) {
+	atomic.AddUint64(&c.sendCalls, 1)
+	if n > 0 {
+		atomic.AddUint64(&c.bytesSent, uint64(n))
+		atomic.StoreInt64(&c.lastWrite, time.Now().UnixNano())
+	}
+}
+
+func (c *statsCounter) onPacketsSent(n int) {
+	atomic.AddUint64(&c.packetsSent, uint64(n))
+}
+
+func (c *statsCounter) onRead(n int) {
+	atomic.AddUint64(&c.bytesRecv, uint64(n))
+	atomic.StoreInt64(&c.lastRead, time.Now().UnixNano())
+}
+
+func (c *statsCounter) onPacketRecv() {
+	atomic.AddUint64(&c.packetsRecv, 1)
+}
+
+// ReadAble passed to PacketReceiver,counts every byte read from the conn including frame headers
+type countReadAble struct {
+	ReadAble
+	stats *statsCounter
+}
+
+func (cr countReadAble) Read(b []byte) (int, error) {
+	n, err := cr.ReadAble.Read(b)
+	if n > 0 {
+		cr.stats.onRead(n)
+	}
+	return n, err
+}
+
+// count bytes read by RecvStream handler
+type countReader struct {
+	io.Reader
+	n int
+}
+
+func (cr *countReader) Read(b []byte) (int, error) {
+	n, err := cr.Reader.Read(b)
+	cr.n += n
+	return n, err
+}
+
+func unixNanoToTime(v int64) time.Time {
+	if v == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, v)
+}
+
+func (c *statsCounter) stats() Stats {
+	return Stats{
+		BytesSent:   atomic.LoadUint64(&c.bytesSent),
+		BytesRecv:   atomic.LoadUint64(&c.bytesRecv),
+		PacketsSent: atomic.LoadUint64(&c.packetsSent),
+		PacketsRecv: atomic.LoadUint64(&c.packetsRecv),
+		SendCalls:   atomic.LoadUint64(&c.sendCalls),
+		LastRead:    unixNanoToTime(atomic.LoadInt64(&c.lastRead)),
+		LastWrite:   unixNanoToTime(atomic.LoadInt64(&c.lastWrite)),
+		Age:         time.Duration(time.Now().UnixNano() - c.created),
+	}
+}
+
+// BytesRecv is taken from the underlying Socket if it implements StatsReporter,so that it counts wire bytes as BytesSent does
+func (s *AsynSocket) Stats() Stats {
+	st := s.stats.stats()
+	if reporter, ok := s.socket.(StatsReporter); ok {
+		st.BytesRecv = reporter.Stats().BytesRecv
+	}
+	st.QueuedObjects = s.QueuedObjects()
+	st.QueuedBytes = s.QueuedBytes()
+	return st
+}
+
+func (base *socketBase) Stats() Stats {
+	return base.stats.stats()
+}
+
+func (wc *webSocket) Stats() Stats {
+	return wc.stats.stats()
+}
+
+func (rs *rateLimitedSocket) Stats() Stats {
+	if reporter, ok := rs.Socket.(StatsReporter); ok {
+		return reporter.Stats()
+	}
+	return Stats{}
+}
@@ -0,0 +1,59 @@
+package netgo
+
+import (
+	"net"
+	"time"
+)
+
+type unixSocket struct {
+	socketBase
+}
+
+func (us *unixSocket) SendBuffers(buffs net.Buffers, deadline ...time.Time) (int64, error) {
+	d := time.Time{}
+	if len(deadline) > 0 && !deadline[0].IsZero() {
+		d = deadline[0]
+	}
+	if err := us.conn.SetWriteDeadline(d); err != nil {
+		return 0, err
+	} else {
+		n, err := buffs.WriteTo(us.conn)
+		us.onSend(int(n), err)
+		return n, err
+	}
+}
+
+var _ Socket = &unixSocket{}
+
+func NewUnixSocket(conn *net.UnixConn, packetReceiver ...PacketReceiver) Socket {
+	s := &unixSocket{}
+	s.init(conn, packetReceiver...)
+	return s
+}
+
+func ListenUnix(nettype string, service string, onNewclient func(*net.UnixConn)) (net.Listener, func(), error) {
+	unixAddr, err := net.ResolveUnixAddr(nettype, service)
+	if nil != err {
+		return nil, nil, err
+	}
+	listener, err := net.ListenUnix(nettype, unixAddr)
+	if nil != err {
+		return nil, nil, err
+	}
+
+	serve := func() {
+		for {
+			conn, e := listener.Accept()
+			if e == nil {
+				onNewclient(conn.(*net.UnixConn))
+			} else if ne, ok := e.(*net.OpError); ok && ne.Temporary() {
+				time.Sleep(time.Millisecond * 10)
+				continue
+			} else {
+				return
+			}
+		}
+	}
+
+	return listener, serve, nil
+}
@@ -0,0 +1,65 @@
+package netgo
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"time"
+)
+
+var (
+	ErrVarintOverflow error = errors.New("varintOverflow")
+)
+
+// PacketReceiver for packets like [uvarint length][payload],the length prefix used by protobuf
+//
+// the returned packet is payload only and refers to the receiver's internal buffer,
+// it is valid until the next call of Recv.
+type VarintLengthReceiver struct {
+	recvBuff
+	maxPacketSize int
+}
+
+// maxPacketSize <= 0 means 65535
+func NewVarintLengthReceiver(maxPacketSize int) *VarintLengthReceiver {
+	if maxPacketSize <= 0 {
+		maxPacketSize = 65535
+	}
+	return &VarintLengthReceiver{
+		maxPacketSize: maxPacketSize,
+	}
+}
+
+func (vr *VarintLengthReceiver) Recv(readable ReadAble, deadline time.Time) ([]byte, error) {
+	for {
+		buffered := vr.buffered()
+		need := 1
+		if l, n := binary.Uvarint(buffered); n < 0 {
+			return nil, ErrVarintOverflow
+		} else if n == 0 {
+			//varint not complete
+			need = len(buffered) + 1
+		} else if l > uint64(vr.maxPacketSize) {
+			return nil, &PacketTooLargeError{Size: l, MaxSize: vr.maxPacketSize}
+		} else {
+			need = n + int(l)
+			if len(buffered) >= need {
+				vr.skip(need)
+				return buffered[n:need], nil
+			}
+		}
+
+		if err := vr.fill(readable, deadline, need); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// append uvarint length prefix for a payload of size bytes,return buffs and size of the prefix
+//
+// helper for ObjCodec.Encode of the VarintLengthReceiver framing
+func AppendUvarintHeader(buffs net.Buffers, size int) (net.Buffers, int) {
+	header := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(header, uint64(size))
+	return append(buffs, header[:n]), n
+}
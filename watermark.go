@@ -0,0 +1,70 @@
+package netgo
+
+import (
+	"sync/atomic"
+)
+
+func (s *AsynSocket) queuedSize(o interface{}) int {
+	switch v := o.(type) {
+	case *sendRequest:
+		return s.queuedSize(v.o)
+	case *SharedPacket:
+		return v.Len()
+	case []byte:
+		return len(v)
+	case string:
+		return len(v)
+	default:
+		if s.sizeOf != nil {
+			return s.sizeOf(o)
+		}
+		return 0
+	}
+}
+
+func (s *AsynSocket) addQueuedBytes(n int) {
+	if n == 0 {
+		return
+	}
+	v := atomic.AddInt64(&s.queuedBytes, int64(n))
+	if s.highWaterMark <= 0 {
+		return
+	} else if (n > 0 && v >= s.highWaterMark) || (n < 0 && v <= s.lowWaterMark) {
+		s.updateWritability()
+	}
+}
+
+func (s *AsynSocket) updateWritability() {
+	var callback func(*AsynSocket)
+	s.writabilityMu.Lock()
+	v := atomic.LoadInt64(&s.queuedBytes)
+	if !s.unwritable && v >= s.highWaterMark {
+		s.unwritable = true
+		callback = s.onUnwritable
+	} else if s.unwritable && v <= s.lowWaterMark {
+		s.unwritable = false
+		callback = s.onWritable
+	}
+	s.writabilityMu.Unlock()
+	//callback may Send,call without lock held
+	if callback != nil {
+		callback(s)
+	}
+}
+
+// false after queued bytes reached HighWaterMark until it dropped to LowWaterMark
+func (s *AsynSocket) IsWritable() bool {
+	s.writabilityMu.Lock()
+	defer s.writabilityMu.Unlock()
+	return !s.unwritable
+}
+
+// estimated bytes of objects queued but not written yet
+func (s *AsynSocket) QueuedBytes() int {
+	return int(atomic.LoadInt64(&s.queuedBytes))
+}
+
+// number of objects in the send queue
+func (s *AsynSocket) QueuedObjects() int {
+	return s.queuedObjects()
+}